@@ -3,11 +3,15 @@ package main
 import (
 	"context"
 	"errors"
+	"expvar"
 	"fmt"
 	"log/slog"
 	"medods-test/internal/api"
 	"medods-test/internal/config"
+	jwtLib "medods-test/internal/lib/jwt"
 	"medods-test/internal/logger"
+	"medods-test/internal/models"
+	"medods-test/internal/services/hasher"
 	"medods-test/internal/storage/postgres"
 	"net/http"
 	"os"
@@ -32,6 +36,18 @@ const (
 
 // @host localhost:8080
 // @BasePath /api/v1/
+
+// @securityDefinitions.basic BasicAuth
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Access токен в формате 'Bearer <token>' или 'DPoP <token>'
+
+// @securityDefinitions.apikey JWT
+// @in header
+// @name Authorization
+// @description Access токен в формате 'Bearer <token>' или 'DPoP <token>'
 func main() {
 
 	ctx := context.Background()
@@ -42,6 +58,33 @@ func main() {
 
 	log := logger.New(cfg.Log)
 
+	err := jwtLib.Setup(jwtLib.Options{
+		Alg:            cfg.JwtAlg,
+		Secret:         cfg.JwtSecret,
+		PrivateKeyPath: cfg.JwtPrivateKey,
+		KeysDir:        cfg.JwtKeysDir,
+		RetireAfter:    cfg.JwtKeyRetireAfter,
+		Issuer:         cfg.JwtIssuer,
+		Audience:       cfg.JwtAudience,
+		HashSecret:     cfg.TokenHashSecret,
+		OIDCIssuer:     cfg.PublicURL,
+	})
+	if err != nil {
+		log.Error("can't setup jwt signing key", "err", err.Error())
+
+		os.Exit(1)
+	}
+
+	if !jwtLib.OIDCEnabled() {
+		log.Warn("OpenID Connect is disabled: ID tokens require an asymmetric JWT_ALG")
+	}
+
+	if cfg.JwtKeysDir == "" {
+		log.Warn("JWT_KEYS_DIR is not set, rotated signing keys will be lost on restart")
+	}
+
+	go rotateKeys(log, cfg.JwtRotateInterval, cfg.JwtKeysReloadInterval)
+
 	storage, err := postgres.New(ctx, log, cfg.DbConnString)
 	if err != nil {
 		log.Error("can't connect to storage", "err", err.Error())
@@ -49,6 +92,17 @@ func main() {
 		os.Exit(1)
 	}
 
+	rekeyed, err := storage.RekeyBlacklist(ctx, jwtLib.Fingerprint)
+	if err != nil {
+		log.Error("can't rekey token blacklist", "err", err.Error())
+
+		os.Exit(1)
+	}
+
+	if rekeyed > 0 {
+		log.Info("token blacklist rekeyed", "count", rekeyed)
+	}
+
 	// err = startMigrations(log, cfg.DbConnString)
 	// if err != nil {
 	// 	log.Error("can't start migrations", "err", err)
@@ -56,7 +110,20 @@ func main() {
 	// 	os.Exit(1)
 	// }
 
-	api := api.New(log, storage)
+	hashPool := hasher.New(cfg.HashWorkers, cfg.HashQueue)
+
+	if cfg.BootstrapClientID != "" {
+		err = bootstrapClient(ctx, storage, hashPool, cfg.BootstrapClientID, cfg.BootstrapClientSecret)
+		if err != nil {
+			log.Error("can't register bootstrap client", "err", err.Error())
+
+			os.Exit(1)
+		}
+
+		log.Info("bootstrap client is registered", "clientID", cfg.BootstrapClientID)
+	}
+
+	api := api.New(log, storage, hashPool, cfg)
 
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
@@ -73,6 +140,25 @@ func main() {
 	}()
 	log.Info("Server is started", "addres", serverAddr)
 
+	// метрики отдаются на отдельном внутреннем адресе: публичному роутеру они не нужны
+	var debugSrv *http.Server
+	if cfg.DebugAddr != "" {
+		debugMux := http.NewServeMux()
+		debugMux.Handle("/debug/vars", expvar.Handler())
+
+		debugSrv = &http.Server{
+			Addr:    cfg.DebugAddr,
+			Handler: debugMux,
+		}
+
+		go func() {
+			if err := debugSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("debug server stopped", "err", err)
+			}
+		}()
+		log.Info("Debug server is started", "addres", cfg.DebugAddr)
+	}
+
 	select {
 	case err := <-chanError:
 		log.Error("Shutting down. Critical error:", "err", err)
@@ -92,6 +178,14 @@ func main() {
 			}
 		}
 
+		if debugSrv != nil {
+			if err := debugSrv.Shutdown(ctx); err != nil {
+				log.Error("debug server shutdown failed", "err", err)
+			}
+		}
+
+		hashPool.Close()
+
 		storage.Close()
 
 		log.Info(InfoDbClosed)
@@ -102,6 +196,85 @@ func main() {
 
 }
 
+// bootstrapClient регистрирует доверенного клиента из конфига, чтобы после миграции
+// было кому выпускать токены. Повторный старт обновляет его секрет
+func bootstrapClient(ctx context.Context, storage *postgres.PostgreStorage, hashPool *hasher.Hasher, clientID string, secret string) error {
+	if secret == "" {
+		return errors.New("BOOTSTRAP_CLIENT_SECRET is empty")
+	}
+
+	secretHash, err := hashPool.Hash(ctx, secret)
+	if err != nil {
+		return fmt.Errorf("failed to hash client secret:%w", err)
+	}
+
+	return storage.SaveClient(ctx, &models.Client{
+		ID:         clientID,
+		Name:       clientID,
+		SecretHash: secretHash,
+		Trusted:    true,
+	})
+}
+
+// rotateKeys ротирует ключ подписи по SIGHUP и, если задан интервал, по расписанию.
+// Ротирует один экземпляр, остальные раз в reloadInterval перечитывают общий каталог
+// ключей (и сразу, увидев незнакомый kid). Выведенные из оборота ключи чистятся раз в час.
+func rotateKeys(log *slog.Logger, interval time.Duration, reloadInterval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	var reload <-chan time.Time
+	if reloadInterval > 0 {
+		ticker := time.NewTicker(reloadInterval)
+		defer ticker.Stop()
+
+		reload = ticker.C
+	}
+
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-hup:
+		case <-tick:
+		case <-reload:
+			if err := jwtLib.Reload(); err != nil {
+				log.Error("failed to reload signing keys", "err", err)
+			}
+
+			continue
+		case <-prune.C:
+			pruned, err := jwtLib.Prune()
+			if err != nil {
+				log.Error("failed to prune signing keys", "err", err)
+			}
+			if len(pruned) > 0 {
+				log.Info("signing keys retired", "kids", pruned)
+			}
+
+			continue
+		}
+
+		kid, err := jwtLib.Rotate()
+		if err != nil {
+			log.Error("failed to rotate signing key", "err", err)
+
+			continue
+		}
+
+		log.Info("signing key rotated", "kid", kid)
+	}
+}
+
 func startMigrations(log *slog.Logger, connString string) error {
 	m, err := migrate.New("file://migrations", connString) // DEBUG: ../../migrations"
 	if err != nil {
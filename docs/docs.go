@@ -15,14 +15,75 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/v1/auth/logout": {
+        "/auth/introspect": {
             "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Проверяет подпись, срок действия, черный список и активность сессии токена.\nДля невалидного или отозванного токена возвращает только active=false.\nВызывает защищенный ресурс (RFC 7662 2.1): конфиденциальный клиент с секретом в HTTP Basic",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Интроспекция токена (RFC 7662)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Проверяемый токен",
+                        "name": "token",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "access_token или refresh_token",
+                        "name": "token_type_hint",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Состояние токена",
+                        "schema": {
+                            "$ref": "#/definitions/introspect.Response"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидные входные данные",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Клиент не аутентифицирован или публичный",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthError"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/logout": {
+            "put": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Выполняет выход пользователя, блокируя текущий токен доступа",
+                "description": "Выполняет выход из текущей сессии, блокируя ее токены. Остальные сессии пользователя остаются активными",
                 "produces": [
                     "application/json"
                 ],
@@ -38,65 +99,636 @@ const docTemplate = `{
                         "name": "Authorization",
                         "in": "header",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof для токена, привязанного к ключу: htm PUT, htu - адрес /auth/logout",
+                        "name": "DPoP",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Успешный выход из системы",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Не авторизован - Неверный или отсутствующий токен",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера - Проблемы при выходе из системы",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/refresh": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Проверяет валидность access и refresh токенов, их принадлежность одной сессии, отсутствие в черном списке. Выдает новую пару токенов, добавляет старые в черный список и обновляет сессию.\nRefresh token читается из cookie \"Cookie:refreshToken=\", а у клиентов без cookie (device flow) - из поля формы refresh_token;\nновый refresh токен возвращается тем же способом\nAccess токен может быть уже истекшим - в пределах REFRESH_ACCESS_LEEWAY.\nПараллельные запросы с одним refresh токеном в пределах REFRESH_GRACE получают одну и ту же новую пару\nДля сессии со scope openid вместе с access токеном выдается новый ID токен (без nonce)\nПара, привязанная к ключу DPoP, обновляется только с proof этого ключа (заголовок DPoP, схема Authorization DPoP);\nproof к непривязанной паре привязывает новую пару к ключу\nКлиент аутентифицируется (HTTP Basic или client_id публичного клиента) и обновляет только сессии, открытые для него",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Refresh tokens"
+                ],
+                "summary": "Обновление пары JWT токенов",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Access токен в формате 'Bearer \u003ctoken\u003e' или 'DPoP \u003ctoken\u003e'",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof: htm POST, htu - адрес /auth/refresh",
+                        "name": "DPoP",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Успешное обновление токенов",
+                        "schema": {
+                            "$ref": "#/definitions/refresh.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Клиент не аутентифицирован",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthError"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Сервис перегружен, повторить после Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/revoke": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Отзывает access или refresh токен вместе с парным ему токеном.\nОтзыв refresh токена завершает сессию, поэтому выданные по нему access токены тоже перестают приниматься.\nПо RFC ответ 200 возвращается и для невалидных/уже отозванных токенов.\nКлиент аутентифицируется (HTTP Basic или client_id публичного клиента) и может отозвать только выданные ему токены",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Отзыв токена (RFC 7009)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Отзываемый токен",
+                        "name": "token",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "access_token или refresh_token",
+                        "name": "token_type_hint",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Токен отозван",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "400": {
+                        "description": "Токен выпущен другому клиенту",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthError"
+                        }
+                    },
+                    "401": {
+                        "description": "Клиент не аутентифицирован",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthError"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/token": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Без grant_type открывает новую сессию пользователя и генерирует для нее пару access и refresh токенов.\nУ одного GUID может быть несколько активных сессий.\ngrant_type=client_credentials выдает клиенту короткоживущий сервисный access токен на себя, без refresh токена и cookie.\ngrant_type=authorization_code меняет код из /authorize и code_verifier (PKCE) на сессию пользователя.\ngrant_type=urn:ietf:params:oauth:grant-type:device_code - опрос устройства по device_code из /device_authorization;\nпока пользователь не подтвердил запрос - authorization_pending, при слишком частом опросе - slow_down.\nПо authorization_code и device_code refresh токен приходит в теле ответа (refresh_token).\ngrant_type=urn:ietf:params:oauth:grant-type:token-exchange (RFC 8693) выдает по access токену пользователя\nтокен с более узким scope/audience и claim act: клиент или сотрудник из actor_token (scope impersonate) действует от имени пользователя.\nПубличный клиент передает только client_id в форме и может использовать только authorization_code и device_code.\nСо scope openid вместе с access токеном выдается ID токен OpenID Connect.\nAccess токен выпускается для одного сервиса (aud): resource из запроса или аудитории клиента по умолчанию.\nС заголовком DPoP (proof по RFC 9449) токен привязывается к ключу клиента (cnf.jkt) и выдается с token_type DPoP.\nКлиент аутентифицируется по HTTP Basic (client_id и секрет) и должен иметь право выпускать токены для GUID",
+                "consumes": [
+                    "application/json",
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Создание новых токенов",
+                "parameters": [
+                    {
+                        "description": "Данные для генерации токенов",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/tokens.Request"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof: htm POST, htu - адрес /auth/token",
+                        "name": "DPoP",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "client_credentials, authorization_code, urn:ietf:params:oauth:grant-type:device_code или urn:ietf:params:oauth:grant-type:token-exchange",
+                        "name": "grant_type",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Код из /authorize",
+                        "name": "code",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "redirect_uri из запроса /authorize",
+                        "name": "redirect_uri",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "PKCE code_verifier",
+                        "name": "code_verifier",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "device_code из /device_authorization",
+                        "name": "device_code",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Токен пользователя для token-exchange",
+                        "name": "subject_token",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "urn:ietf:params:oauth:token-type:access_token",
+                        "name": "subject_token_type",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Токен сотрудника со scope impersonate",
+                        "name": "actor_token",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "urn:ietf:params:oauth:token-type:access_token",
+                        "name": "actor_token_type",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Сервис, для которого нужен токен",
+                        "name": "audience",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Запрошенные scopes через пробел",
+                        "name": "scope",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Сервис (aud), для которого нужен access токен",
+                        "name": "resource",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Set-Cookie: refreshToken={token}; Path=/; Domain=localhost; Max-Age={liveRefresh}; HttpOnly",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Неизвестный grant_type или клиенту не разрешен GUID/scope",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthError"
+                        }
+                    },
+                    "401": {
+                        "description": "Клиент не аутентифицирован",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthError"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "503": {
+                        "description": "Сервис перегружен, повторить после Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/authorize": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Пользователь, вошедший через access токен, разрешает клиенту доступ.\nСервис перенаправляет на зарегистрированный у клиента redirect_uri с одноразовым кодом (живет минуту) и state.\nОбязателен PKCE с методом S256. Код меняется на токены в /auth/token с grant_type=authorization_code",
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Запрос кода авторизации (OAuth 2.0 + PKCE)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Access токен пользователя в формате 'Bearer \u003ctoken\u003e'",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "code",
+                        "name": "response_type",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Клиент",
+                        "name": "client_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Зарегистрированный redirect_uri клиента",
+                        "name": "redirect_uri",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Запрошенные scopes через пробел, не шире scope access токена. Пусто - default_scope клиента",
+                        "name": "scope",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Значение, которое вернется клиенту",
+                        "name": "state",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "PKCE code_challenge",
+                        "name": "code_challenge",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "S256",
+                        "name": "code_challenge_method",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Вернется в ID токене при scope openid",
+                        "name": "nonce",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "302": {
+                        "description": "Location: {redirect_uri}?error={error}\u0026state={state}",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Неизвестный клиент или незарегистрированный redirect_uri",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthError"
+                        }
+                    },
+                    "401": {
+                        "description": "Пользователь не авторизован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Токен получен обменом (act) или выдан не сессии пользователя",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/device": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Пользователь вводит user_code с экрана устройства и одобряет или отклоняет запрос.\nОдобренные scopes ограничиваются ролями пользователя и scope его access токена.\nПодтверждать можно только токеном самой сессии пользователя, неверные user_code ограничены по числу",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Подтверждение устройства (RFC 8628)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Access токен пользователя в формате 'Bearer \u003ctoken\u003e'",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "user_code и решение",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/verification.Request"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Решение записано",
+                        "schema": {
+                            "$ref": "#/definitions/verification.Response"
+                        }
+                    },
+                    "400": {
+                        "description": "Невалидные входные данные, запрос истек или scope не разрешен",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Неавторизован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Токен получен обменом (act) или выдан не сессии пользователя",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "404": {
+                        "description": "Запрос с таким user_code не найден",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "429": {
+                        "description": "Слишком много неверных user_code",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/device_authorization": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Устройство без браузера получает device_code и user_code. Пользователь вводит user_code на verification_uri,\nа устройство опрашивает /auth/token с grant_type=urn:ietf:params:oauth:grant-type:device_code не чаще interval",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Запрос авторизации устройства (RFC 8628)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Публичный клиент без HTTP Basic",
+                        "name": "client_id",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Запрошенные scopes через пробел",
+                        "name": "scope",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Коды устройства",
+                        "schema": {
+                            "$ref": "#/definitions/authorization.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Клиент не аутентифицирован",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthError"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/me": {
+            "get": {
+                "security": [
+                    {
+                        "JWT": []
+                    }
+                ],
+                "description": "Возвращает GUID пользователя из JWT токена. /userinfo - тот же ответ в формате UserInfo OpenID Connect,\nдоступен со scope openid; роли возвращаются со scope profile",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Получение данных пользователя",
+                "responses": {
+                    "200": {
+                        "description": "Успешное получение данных",
+                        "schema": {
+                            "$ref": "#/definitions/me.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Неавторизованный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/me/sessions": {
+            "get": {
+                "security": [
+                    {
+                        "JWT": []
                     }
                 ],
+                "description": "Возвращает активные сессии пользователя: устройство, подсеть клиента, время входа и последнего обновления токенов.\nСессия, к которой относится access токен запроса, помечена current=true",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sessions"
+                ],
+                "summary": "Список активных сессий",
                 "responses": {
                     "200": {
-                        "description": "Успешный выход из системы",
+                        "description": "Список сессий",
                         "schema": {
-                            "$ref": "#/definitions/response.Response"
+                            "$ref": "#/definitions/list.Response"
                         }
                     },
                     "401": {
-                        "description": "Не авторизован - Неверный или отсутствующий токен",
+                        "description": "Неавторизованный запрос",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "500": {
-                        "description": "Ошибка сервера - Проблемы при выходе из системы",
+                        "description": "Внутренняя ошибка сервера",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/response.Response"
                         }
                     }
                 }
-            }
-        },
-        "/auth/token": {
-            "post": {
-                "description": "Генерирует новую пару access и refresh токенов для пользователя",
-                "consumes": [
-                    "application/json"
+            },
+            "delete": {
+                "security": [
+                    {
+                        "JWT": []
+                    }
                 ],
+                "description": "Закрывает все сессии пользователя, кроме текущей",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Auth"
-                ],
-                "summary": "Создание новых токенов",
-                "parameters": [
-                    {
-                        "description": "Данные для генерации токенов",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/tokens.Request"
-                        }
-                    }
+                    "Sessions"
                 ],
+                "summary": "Выход на всех других устройствах",
                 "responses": {
                     "200": {
-                        "description": "Set-Cookie: refreshToken={token}; Path=/; Domain=localhost; Max-Age={liveRefresh}; HttpOnly",
+                        "description": "Число завершенных сессий",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/terminateothers.Response"
                         }
                     },
-                    "400": {
-                        "description": "Невалидные входные данные",
+                    "401": {
+                        "description": "Неавторизованный запрос",
                         "schema": {
-                            "$ref": "#/definitions/response.Response"
+                            "type": "string"
                         }
                     },
                     "500": {
@@ -108,47 +740,49 @@ const docTemplate = `{
                 }
             }
         },
-        "/refresh": {
-            "post": {
-                "description": "Проверяет валидность access и refresh токенов, их соответствие, отсутствие в черном списке. Выдает новую пару токенов, добавляет старые в черный список и обновляет данные пользователя.\nRefresh token читается из cookie \"Cookie:refreshToken=\"",
-                "consumes": [
-                    "application/json"
+        "/me/sessions/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "JWT": []
+                    }
                 ],
+                "description": "Закрывает одну из сессий пользователя. Ее refresh и access токены перестают приниматься.\nМожно закрыть и текущую сессию - это равносильно выходу",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Refresh tokens"
+                    "Sessions"
                 ],
-                "summary": "Обновление пары JWT токенов",
+                "summary": "Завершение сессии",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Access токен в формате 'Bearer \u003ctoken\u003e'",
-                        "name": "Authorization",
-                        "in": "header",
+                        "description": "ID сессии",
+                        "name": "id",
+                        "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Успешное обновление токенов",
-                        "schema": {
-                            "$ref": "#/definitions/refresh.Response"
-                        }
-                    },
-                    "400": {
-                        "description": "Некорректный запрос (например, GUID уже существует)",
+                        "description": "Сессия завершена",
                         "schema": {
                             "$ref": "#/definitions/response.Response"
                         }
                     },
                     "401": {
-                        "description": "Неавторизован (невалидные токены, токены в черном списке и т.д.)",
+                        "description": "Неавторизованный запрос",
                         "schema": {
                             "type": "string"
                         }
                     },
+                    "404": {
+                        "description": "Сессия не найдена или уже завершена",
+                        "schema": {
+                            "$ref": "#/definitions/response.Response"
+                        }
+                    },
                     "500": {
                         "description": "Внутренняя ошибка сервера",
                         "schema": {
@@ -158,24 +792,53 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/guid": {
+        "/userinfo": {
             "get": {
                 "security": [
                     {
                         "JWT": []
                     }
                 ],
-                "description": "Возвращает GUID пользователя из JWT токена",
+                "description": "Возвращает GUID пользователя из JWT токена. /userinfo - тот же ответ в формате UserInfo OpenID Connect,\nдоступен со scope openid; роли возвращаются со scope profile",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Получение данных пользователя",
+                "responses": {
+                    "200": {
+                        "description": "Успешное получение данных",
+                        "schema": {
+                            "$ref": "#/definitions/me.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Неавторизованный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "JWT": []
+                    }
+                ],
+                "description": "Возвращает GUID пользователя из JWT токена. /userinfo - тот же ответ в формате UserInfo OpenID Connect,\nдоступен со scope openid; роли возвращаются со scope profile",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Auth"
                 ],
-                "summary": "Получение GUID пользователя",
+                "summary": "Получение данных пользователя",
                 "responses": {
                     "200": {
-                        "description": "Успешное получение GUID",
+                        "description": "Успешное получение данных",
                         "schema": {
                             "$ref": "#/definitions/me.Response"
                         }
@@ -191,11 +854,162 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "authorization.Response": {
+            "type": "object",
+            "properties": {
+                "device_code": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "type": "integer"
+                },
+                "interval": {
+                    "type": "integer"
+                },
+                "user_code": {
+                    "type": "string"
+                },
+                "verification_uri": {
+                    "type": "string"
+                },
+                "verification_uri_complete": {
+                    "type": "string"
+                }
+            }
+        },
+        "introspect.Response": {
+            "type": "object",
+            "properties": {
+                "act": {
+                    "description": "Act - кто действует от имени sub, у токенов из token-exchange",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/jwt.Actor"
+                        }
+                    ]
+                },
+                "active": {
+                    "type": "boolean"
+                },
+                "aud": {
+                    "type": "string"
+                },
+                "client_id": {
+                    "type": "string"
+                },
+                "cnf": {
+                    "description": "Cnf - ключ DPoP, к которому привязан токен (RFC 9449 6.2)",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/jwt.Confirmation"
+                        }
+                    ]
+                },
+                "exp": {
+                    "type": "integer"
+                },
+                "iat": {
+                    "type": "integer"
+                },
+                "iss": {
+                    "type": "string"
+                },
+                "jti": {
+                    "type": "string"
+                },
+                "nbf": {
+                    "type": "integer"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "sub": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.Actor": {
+            "type": "object",
+            "properties": {
+                "act": {
+                    "$ref": "#/definitions/jwt.Actor"
+                },
+                "client_id": {
+                    "type": "string"
+                },
+                "sub": {
+                    "type": "string"
+                }
+            }
+        },
+        "jwt.Confirmation": {
+            "type": "object",
+            "properties": {
+                "jkt": {
+                    "type": "string"
+                }
+            }
+        },
+        "list.Response": {
+            "type": "object",
+            "properties": {
+                "response": {
+                    "$ref": "#/definitions/response.Response"
+                },
+                "sessions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/list.Session"
+                    }
+                }
+            }
+        },
+        "list.Session": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "current": {
+                    "type": "boolean"
+                },
+                "device": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_refresh": {
+                    "type": "string"
+                },
+                "location": {
+                    "type": "string"
+                }
+            }
+        },
         "me.Response": {
             "type": "object",
             "properties": {
                 "guid": {
                     "type": "string"
+                },
+                "roles": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "sub": {
+                    "type": "string"
                 }
             }
         },
@@ -205,8 +1019,29 @@ const docTemplate = `{
                 "accessToken": {
                     "type": "string"
                 },
+                "idToken": {
+                    "type": "string"
+                },
+                "refreshToken": {
+                    "description": "RefreshToken - новый refresh токен для клиентов без cookie, браузер получает его в cookie",
+                    "type": "string"
+                },
                 "response": {
                     "$ref": "#/definitions/response.Response"
+                },
+                "tokenType": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.OAuthError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "error_description": {
+                    "type": "string"
                 }
             }
         },
@@ -222,6 +1057,17 @@ const docTemplate = `{
                 }
             }
         },
+        "terminateothers.Response": {
+            "type": "object",
+            "properties": {
+                "response": {
+                    "$ref": "#/definitions/response.Response"
+                },
+                "revoked": {
+                    "type": "integer"
+                }
+            }
+        },
         "tokens.Request": {
             "type": "object",
             "required": [
@@ -230,6 +1076,10 @@ const docTemplate = `{
             "properties": {
                 "guid": {
                     "type": "string"
+                },
+                "scope": {
+                    "description": "Scope - запрошенные scopes через пробел. Пусто - все, что разрешают роли пользователя",
+                    "type": "string"
                 }
             }
         },
@@ -239,11 +1089,97 @@ const docTemplate = `{
                 "accessToken": {
                     "type": "string"
                 },
+                "idToken": {
+                    "type": "string"
+                },
+                "response": {
+                    "$ref": "#/definitions/response.Response"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "tokenType": {
+                    "type": "string"
+                }
+            }
+        },
+        "tokens.TokenResponse": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "type": "integer"
+                },
+                "id_token": {
+                    "type": "string"
+                },
+                "issued_token_type": {
+                    "description": "IssuedTokenType - только у token-exchange, RFC 8693 2.2.1",
+                    "type": "string"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "verification.Request": {
+            "type": "object",
+            "required": [
+                "approve",
+                "user_code"
+            ],
+            "properties": {
+                "approve": {
+                    "description": "Approve - решение пользователя, false отклоняет запрос устройства",
+                    "type": "boolean"
+                },
+                "user_code": {
+                    "type": "string"
+                }
+            }
+        },
+        "verification.Response": {
+            "type": "object",
+            "properties": {
+                "clientId": {
+                    "type": "string"
+                },
                 "response": {
                     "$ref": "#/definitions/response.Response"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "BasicAuth": {
+            "type": "basic"
+        },
+        "BearerAuth": {
+            "description": "Access токен в формате 'Bearer \u003ctoken\u003e' или 'DPoP \u003ctoken\u003e'",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        },
+        "JWT": {
+            "description": "Access токен в формате 'Bearer \u003ctoken\u003e' или 'DPoP \u003ctoken\u003e'",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
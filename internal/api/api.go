@@ -3,11 +3,30 @@ package api
 import (
 	"log/slog"
 	_ "medods-test/docs"
+	"medods-test/internal/api/handlers/auth/authorize"
+	"medods-test/internal/api/handlers/auth/introspect"
 	"medods-test/internal/api/handlers/auth/logout"
+	"medods-test/internal/api/handlers/auth/revoke"
 	"medods-test/internal/api/handlers/auth/token/refresh"
 	"medods-test/internal/api/handlers/auth/token/tokens"
+	"medods-test/internal/api/handlers/device/authorization"
+	"medods-test/internal/api/handlers/device/verification"
+	"medods-test/internal/api/handlers/discovery"
+	"medods-test/internal/api/handlers/jwks"
 	"medods-test/internal/api/handlers/me"
+	"medods-test/internal/api/handlers/sessions/list"
+	"medods-test/internal/api/handlers/sessions/terminate"
+	"medods-test/internal/api/handlers/sessions/terminateothers"
+	"medods-test/internal/api/middlewares/access"
 	"medods-test/internal/api/middlewares/auth"
+	"medods-test/internal/api/middlewares/client"
+	"medods-test/internal/config"
+	"medods-test/internal/lib/dpop"
+	jwtLib "medods-test/internal/lib/jwt"
+	"medods-test/internal/services/attempts"
+	"medods-test/internal/services/hasher"
+	"medods-test/internal/services/replay"
+	"medods-test/internal/services/revocation"
 	"medods-test/internal/storage"
 
 	"github.com/gin-contrib/requestid"
@@ -16,16 +35,24 @@ import (
 )
 
 type API struct {
-	Router  *gin.Engine
-	Storage storage.Storage
-	Log     *slog.Logger
+	Router     *gin.Engine
+	Storage    storage.Storage
+	Revocation *revocation.Cache
+	DPoP       *dpop.Verifier
+	Hasher     *hasher.Hasher
+	Log        *slog.Logger
+	Config     *config.Config
 }
 
-func New(log *slog.Logger, storage storage.Storage) *API {
+func New(log *slog.Logger, storage storage.Storage, hasher *hasher.Hasher, cfg *config.Config) *API {
 	api := &API{
-		Router:  gin.New(),
-		Storage: storage,
-		Log:     log,
+		Router:     gin.New(),
+		Storage:    storage,
+		Revocation: revocation.New(storage, cfg.RevocationCacheTTL),
+		DPoP:       dpop.NewVerifier(cfg.PublicURL, cfg.DPoPProofWindow, replay.New()),
+		Hasher:     hasher,
+		Log:        log,
+		Config:     cfg,
 	}
 
 	api.Endpoints()
@@ -35,17 +62,47 @@ func New(log *slog.Logger, storage storage.Storage) *API {
 
 func (api *API) Endpoints() {
 
+	api.Router.GET("/.well-known/jwks.json", jwks.New(api.Log))
+	api.Router.GET("/.well-known/openid-configuration", discovery.New(api.Log, api.Config.PublicURL, api.Config.DeviceVerificationURI != ""))
+
 	v1 := api.Router.Group("api/v1/")
 
 	v1.Use(requestid.New())
 	v1.Use(gin.Logger())
 
+	v1.GET("/authorize", auth.AuthMiddleware(api.Log, api.Revocation, api.Config.JwtAudience, api.DPoP), access.RequireUser(api.Log), authorize.New(api.Log, api.Storage))
+
+	// device flow включается только вместе со страницей, на которой пользователь вводит user_code:
+	// /device - JSON API этой страницы, браузер на него не ведут
+	if api.Config.DeviceVerificationURI != "" {
+		v1.POST("/device_authorization", client.Authenticate(api.Log, api.Storage, api.Hasher), authorization.New(api.Log, api.Storage, api.Config.DeviceVerificationURI))
+		v1.POST("/device", auth.AuthMiddleware(api.Log, api.Revocation, api.Config.JwtAudience, api.DPoP), access.RequireUser(api.Log), verification.New(api.Log, api.Storage, attempts.New(api.Config.DeviceVerificationMaxFailures, api.Config.DeviceVerificationLockout)))
+	}
+
 	authV1 := v1.Group("/auth")
-	authV1.POST("/token", tokens.New(api.Log, api.Storage))
-	authV1.POST("/refresh", refresh.New(api.Log, api.Storage))
-	authV1.PUT("/logout", logout.New(api.Log, api.Storage))
+	authV1.POST("/token", client.Authenticate(api.Log, api.Storage, api.Hasher), tokens.New(api.Log, api.Storage, api.Hasher, api.DPoP))
+	authV1.POST("/refresh", client.Authenticate(api.Log, api.Storage, api.Hasher), refresh.New(api.Log, api.Storage, api.Hasher, refresh.Config{
+		AccessLeeway: api.Config.RefreshAccessLeeway,
+		Grace:        api.Config.RefreshGrace,
+	}, api.DPoP))
+	authV1.PUT("/logout", logout.New(api.Log, api.Storage, api.DPoP, api.Revocation))
+	authV1.POST("/revoke", client.Authenticate(api.Log, api.Storage, api.Hasher), revoke.New(api.Log, api.Storage, api.Revocation))
+	authV1.POST("/introspect", client.Authenticate(api.Log, api.Storage, api.Hasher), client.RequireConfidential(api.Log), introspect.New(api.Log, api.Storage))
+
+	userinfoV1 := v1.Group("/userinfo")
+	userinfoV1.Use(auth.AuthMiddleware(api.Log, api.Revocation, api.Config.JwtAudience, api.DPoP), access.RequireUser(api.Log), access.RequireScope(api.Log, jwtLib.ScopeOpenID))
+	userinfoV1.GET("", me.New(api.Log))
+	userinfoV1.POST("", me.New(api.Log))
+
+	meV1 := v1.Group("/me")
+	meV1.Use(auth.AuthMiddleware(api.Log, api.Revocation, api.Config.JwtAudience, api.DPoP), access.RequireUser(api.Log))
+	meV1.GET("", access.RequireScope(api.Log, "profile"), me.New(api.Log))
 
-	v1.GET("/me", auth.AuthMiddleware(api.Log, api.Storage), me.New(api.Log))
+	sessionsV1 := meV1.Group("/sessions")
+	sessionsV1.Use(access.RequireScope(api.Log, "sessions"))
+	sessionsV1.GET("", list.New(api.Log, api.Storage))
+	sessionsV1.DELETE("", terminateothers.New(api.Log, api.Storage))
+	sessionsV1.DELETE("/:id", terminate.New(api.Log, api.Storage, api.Revocation))
 
 	v1.GET("/swagger/*any", gin.WrapH(httpSwagger.Handler()))
 
@@ -0,0 +1,271 @@
+package authorize
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"medods-test/internal/api/middlewares/auth"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/jwt"
+	"medods-test/internal/lib/pkce"
+	"medods-test/internal/lib/scope"
+	"medods-test/internal/models"
+	"medods-test/internal/storage"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+const ResponseTypeCode = "code"
+
+var liveCode = time.Minute
+
+type Request struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+	// Nonce - значение клиента, которое вернется в ID токене (OpenID Connect)
+	Nonce string `form:"nonce"`
+}
+
+type Storage interface {
+	FindClient(ctx context.Context, clientID string) (*models.Client, error)
+	ClientHasRedirectURI(ctx context.Context, clientID string, redirectURI string) (bool, error)
+	UserPermissions(ctx context.Context, guid string) (*models.Permissions, error)
+	FindSession(ctx context.Context, sessionID string) (*models.Session, error)
+	SaveAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error
+}
+
+// @Summary Запрос кода авторизации (OAuth 2.0 + PKCE)
+// @Description Пользователь, вошедший через access токен, разрешает клиенту доступ.
+// @Description Сервис перенаправляет на зарегистрированный у клиента redirect_uri с одноразовым кодом (живет минуту) и state.
+// @Description Обязателен PKCE с методом S256. Код меняется на токены в /auth/token с grant_type=authorization_code
+// @Tags Auth
+// @Security BearerAuth
+// @Param Authorization header string true "Access токен пользователя в формате 'Bearer <token>'"
+// @Param response_type query string true "code"
+// @Param client_id query string true "Клиент"
+// @Param redirect_uri query string true "Зарегистрированный redirect_uri клиента"
+// @Param scope query string false "Запрошенные scopes через пробел, не шире scope access токена. Пусто - default_scope клиента"
+// @Param state query string false "Значение, которое вернется клиенту"
+// @Param code_challenge query string true "PKCE code_challenge"
+// @Param code_challenge_method query string true "S256"
+// @Param nonce query string false "Вернется в ID токене при scope openid"
+// @Success 302 {string} string "Location: {redirect_uri}?code={code}&state={state}"
+// @Failure 302 {string} string "Location: {redirect_uri}?error={error}&state={state}"
+// @Failure 400 {object} response.OAuthError "Неизвестный клиент или незарегистрированный redirect_uri"
+// @Failure 401 {string} string "Пользователь не авторизован"
+// @Failure 403 {object} response.Response "Токен получен обменом (act) или выдан не сессии пользователя"
+// @Failure 500 {object} response.Response "Внутренняя ошибка сервера"
+// @Router /authorize [get]
+func New(log *slog.Logger, storager Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		claims, ok := auth.GetClaims(c)
+		if !ok {
+			logHandler.Error("failed to get claims from context")
+
+			c.JSON(http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		// код открывает сессию с refresh токеном на неделю: короткий обмененный (act)
+		// или сервисный токен не должен превращаться в долгий вход от имени пользователя
+		if !claims.IsSessionOwner() {
+			logHandler.Warn("authorization with a delegated or service token", "sub", claims.Subject)
+
+			c.JSON(http.StatusForbidden, response.Error("Forbidden"))
+			return
+		}
+
+		var req Request
+
+		if err := c.ShouldBindQuery(&req); err != nil {
+			logHandler.Error("failed to decode query", "error", err.Error())
+
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidRequest, "failed decode query"))
+			return
+		}
+
+		logHandler = logHandler.With("clientID", req.ClientID)
+
+		// пока клиент и redirect_uri не проверены, ошибку нельзя отправлять редиректом:
+		// иначе /authorize становится открытым редиректом
+		client, err := storager.FindClient(ctx, req.ClientID)
+		if err != nil {
+			if errors.Is(err, storage.ErrClientNotFound) {
+				logHandler.Info("client is not registered")
+
+				c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidClient, ""))
+				return
+			}
+
+			logHandler.Error("failed to find client", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		if !client.IsActive {
+			logHandler.Info("client is disabled")
+
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidClient, ""))
+			return
+		}
+
+		registered, err := storager.ClientHasRedirectURI(ctx, client.ID, req.RedirectURI)
+		if err != nil {
+			logHandler.Error("failed to check redirect uri", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		if !registered {
+			logHandler.Warn("redirect uri is not registered", "redirectURI", req.RedirectURI)
+
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidRequest, "redirect_uri is not registered"))
+			return
+		}
+
+		if req.ResponseType != ResponseTypeCode {
+			logHandler.Info("unsupported response type", "responseType", req.ResponseType)
+
+			redirect(c, req.RedirectURI, url.Values{"error": {"unsupported_response_type"}, "state": {req.State}})
+			return
+		}
+
+		if req.CodeChallengeMethod != pkce.MethodS256 || !pkce.ValidChallenge(req.CodeChallenge) {
+			logHandler.Info("missing or invalid PKCE challenge", "method", req.CodeChallengeMethod)
+
+			redirect(c, req.RedirectURI, url.Values{
+				"error":             {response.ErrInvalidRequest},
+				"error_description": {"code_challenge with S256 is required"},
+				"state":             {req.State},
+			})
+			return
+		}
+
+		permissions, err := storager.UserPermissions(ctx, claims.Subject)
+		if err != nil {
+			logHandler.Error("failed to get user permissions", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		// без scope клиент получает свой scope по умолчанию, а не все, что разрешают роли (RFC 6749 3.3)
+		requested := scope.Parse(req.Scope)
+		if len(requested) == 0 {
+			requested = scope.Parse(client.DefaultScope)
+		}
+
+		if len(requested) == 0 {
+			logHandler.Info("scope is required: client has no default scope")
+
+			redirect(c, req.RedirectURI, url.Values{
+				"error":             {response.ErrInvalidScope},
+				"error_description": {"scope is required"},
+				"state":             {req.State},
+			})
+			return
+		}
+
+		if !jwt.OIDCEnabled() && slices.Contains(requested, jwt.ScopeOpenID) {
+			logHandler.Info("openid scope requested, but OpenID Connect is disabled")
+
+			redirect(c, req.RedirectURI, url.Values{
+				"error":             {response.ErrInvalidScope},
+				"error_description": {"openid is not supported"},
+				"state":             {req.State},
+			})
+			return
+		}
+
+		// код не может дать больше, чем токен, которым пользователь его разрешил:
+		// иначе узкий или делегированный токен выпускал бы код на все scopes ролей
+		allowed := scope.Intersect(scope.Parse(claims.Scope), permissions.Scopes)
+
+		scopes, err := scope.Narrow(requested, allowed)
+		if err != nil {
+			logHandler.Info("requested scope is not allowed", "error", err.Error())
+
+			redirect(c, req.RedirectURI, url.Values{"error": {response.ErrInvalidScope}, "state": {req.State}})
+			return
+		}
+
+		// auth_time ID токена - время входа сессии, из которой пользователь разрешил доступ
+		session, err := storager.FindSession(ctx, claims.SessionID)
+		if err != nil {
+			logHandler.Error("failed to find user session", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		code, err := jwt.NewCode()
+		if err != nil {
+			logHandler.Error("failed to generate code", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		err = storager.SaveAuthorizationCode(ctx, &models.AuthorizationCode{
+			CodeHash:      jwt.Fingerprint(code),
+			ClientID:      client.ID,
+			GUID:          claims.Subject,
+			RedirectURI:   req.RedirectURI,
+			Scope:         scope.Join(scopes),
+			CodeChallenge: req.CodeChallenge,
+			Nonce:         req.Nonce,
+			AuthTime:      session.AuthTime,
+			ExpiresAt:     time.Now().Add(liveCode),
+		})
+		if err != nil {
+			logHandler.Error("failed to save authorization code", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		redirect(c, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+	}
+}
+
+// redirect добавляет params к query redirect_uri, сохраняя его собственные параметры.
+// Пустой state не передается
+func redirect(c *gin.Context, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidRequest, "invalid redirect_uri"))
+		return
+	}
+
+	if params.Get("state") == "" {
+		params.Del("state")
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+
+	target.RawQuery = query.Encode()
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, target.String())
+}
@@ -0,0 +1,212 @@
+package introspect
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/jwt"
+	"medods-test/internal/models"
+	"medods-test/internal/storage"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	HintAccessToken  = "access_token"
+	HintRefreshToken = "refresh_token"
+)
+
+type Request struct {
+	Token         string `form:"token" validate:"required"`
+	TokenTypeHint string `form:"token_type_hint" validate:"omitempty,oneof=access_token refresh_token"`
+}
+
+// Response - ответ по RFC 7662. Для невалидного токена заполнено только active
+type Response struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Nbf       int64  `json:"nbf,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Aud       string `json:"aud,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	// Act - кто действует от имени sub, у токенов из token-exchange
+	Act *jwt.Actor `json:"act,omitempty"`
+	// Cnf - ключ DPoP, к которому привязан токен (RFC 9449 6.2)
+	Cnf *jwt.Confirmation `json:"cnf,omitempty"`
+}
+
+type Storage interface {
+	IsBlocked(ctx context.Context, fingerprint string) (bool, error)
+	FindSession(ctx context.Context, sessionID string) (*models.Session, error)
+	FindSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error)
+}
+
+// @Summary Интроспекция токена (RFC 7662)
+// @Description Проверяет подпись, срок действия, черный список и активность сессии токена.
+// @Description Для невалидного или отозванного токена возвращает только active=false.
+// @Description Вызывает защищенный ресурс (RFC 7662 2.1): конфиденциальный клиент с секретом в HTTP Basic
+// @Tags Auth
+// @Security BasicAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Проверяемый токен"
+// @Param token_type_hint formData string false "access_token или refresh_token"
+// @Success 200 {object} Response "Состояние токена"
+// @Failure 400 {object} response.Response "Невалидные входные данные"
+// @Failure 401 {object} response.OAuthError "Клиент не аутентифицирован или публичный"
+// @Failure 500 {object} response.Response "Внутренняя ошибка сервера"
+// @Router /auth/introspect [post]
+func New(log *slog.Logger, storager Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		var req Request
+
+		if err := c.ShouldBind(&req); err != nil {
+			logHandler.Error("failed to decode request body", "error", err.Error())
+
+			c.JSON(http.StatusBadRequest, response.Error("failed decode body"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			validatorErr := err.(validator.ValidationErrors)
+
+			logHandler.Error("invalid request", "err", err.Error())
+
+			c.JSON(http.StatusBadRequest, response.ValidationError(validatorErr))
+			return
+		}
+
+		lookups := []lookup{introspectAccess, introspectRefresh}
+		if req.TokenTypeHint == HintRefreshToken {
+			lookups = []lookup{introspectRefresh, introspectAccess}
+		}
+
+		for _, introspect := range lookups {
+			resp, err := introspect(ctx, storager, req.Token)
+			if err != nil {
+				logHandler.Error("failed to introspect token", "error", err)
+
+				c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+				return
+			}
+
+			if resp != nil {
+				c.JSON(http.StatusOK, resp)
+				return
+			}
+		}
+
+		logHandler.Info("token is not active")
+
+		c.JSON(http.StatusOK, Response{Active: false})
+	}
+}
+
+// lookup возвращает nil без ошибки, если токен не активен или это токен другого типа
+type lookup func(ctx context.Context, storager Storage, token string) (*Response, error)
+
+func introspectAccess(ctx context.Context, storager Storage, token string) (*Response, error) {
+	claims, err := jwt.VerifyAnyAudience(token, jwt.TypeAccess)
+	if err != nil {
+		return nil, nil
+	}
+
+	blocked, err := storager.IsBlocked(ctx, jwt.Fingerprint(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if blocked {
+		return nil, nil
+	}
+
+	resp := &Response{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: HintAccessToken,
+		Sub:       claims.Subject,
+		Exp:       claims.ExpiresAt,
+		Iat:       claims.IssuedAt,
+		Nbf:       claims.NotBefore,
+		Jti:       claims.Id,
+		Act:       claims.Act,
+		Cnf:       claims.Cnf,
+		Iss:       claims.Issuer,
+		Aud:       claims.Audience,
+	}
+
+	// у сервисного токена сессии нет, достаточно подписи и черного списка
+	if claims.IsService() {
+		return resp, nil
+	}
+
+	session, err := storager.FindSession(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if !session.IsActive || session.GUID != claims.Subject {
+		return nil, nil
+	}
+
+	resp.SessionID = session.ID
+
+	return resp, nil
+}
+
+func introspectRefresh(ctx context.Context, storager Storage, token string) (*Response, error) {
+	tokenHash := jwt.Fingerprint(token)
+
+	session, err := storager.FindSessionByTokenHash(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if !session.IsActive || time.Now().After(session.ExpiresAt) {
+		return nil, nil
+	}
+
+	blocked, err := storager.IsBlocked(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if blocked {
+		return nil, nil
+	}
+
+	return &Response{
+		Active:    true,
+		Scope:     session.Scope,
+		ClientID:  session.ClientID,
+		TokenType: HintRefreshToken,
+		Sub:       session.GUID,
+		Exp:       session.ExpiresAt.Unix(),
+		Iat:       session.UpdatedAt.Unix(),
+		SessionID: session.ID,
+	}, nil
+}
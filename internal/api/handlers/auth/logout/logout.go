@@ -4,36 +4,47 @@ import (
 	"context"
 	"log/slog"
 	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/dpop"
 	libJwt "medods-test/internal/lib/jwt"
 	"medods-test/internal/models"
 	"net/http"
-	"strconv"
 	"strings"
 
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 )
 
 type Storage interface {
-	BlockToken(ctx context.Context, hashedToken string, idToken string) error
-	IsBlocked(ctx context.Context, hashedToken string) (bool, error)
-	FindByGUID(ctx context.Context, guid string) (*models.UserInfo, int, error)
-	Logout(ctx context.Context, guid string) error
+	BlockToken(ctx context.Context, fingerprint string, sessionID string) error
+	IsBlocked(ctx context.Context, fingerprint string) (bool, error)
+	FindRefreshTokenByJTI(ctx context.Context, jti string) (*models.RefreshToken, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+}
+
+// Proofs проверяет DPoP proof запроса. В api это dpop.Verifier
+type Proofs interface {
+	Verify(r *http.Request, accessToken string, jkt string) (*dpop.Proof, error)
+	Consume(proof *dpop.Proof, partition string) error
+}
+
+// Revocations - кеш проверки отзыва этого экземпляра. В api это revocation.Cache
+type Revocations interface {
+	Forget(sessionID string)
 }
 
 // @Summary Выход пользователя из системы
-// @Description Выполняет выход пользователя, блокируя текущий токен доступа
+// @Description Выполняет выход из текущей сессии, блокируя ее токены. Остальные сессии пользователя остаются активными
 // @Tags logout
 // @Security BearerAuth
 // @Produce json
 // @Success 200 {object} response.Response "Успешный выход из системы"
 // @Failure 401 {string} string "Не авторизован - Неверный или отсутствующий токен"
 // @Failure 500 {string} string "Ошибка сервера - Проблемы при выходе из системы"
-// @Router /api/v1/auth/logout [post]
+// @Router /auth/logout [put]
 //
 // @Param Authorization header string true "Токен доступа" default(Bearer <ваш_токен>)
-func New(log *slog.Logger, storage Storage) gin.HandlerFunc {
+// @Param DPoP header string false "DPoP proof для токена, привязанного к ключу: htm PUT, htu - адрес /auth/logout"
+func New(log *slog.Logger, storage Storage, proofs Proofs, revocations Revocations) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		ctx := c.Request.Context()
@@ -53,56 +64,69 @@ func New(log *slog.Logger, storage Storage) gin.HandlerFunc {
 
 		authTokens := strings.Split(authHeader, " ")
 
-		if len(authTokens) != 2 || authTokens[0] != "Bearer" {
+		if len(authTokens) != 2 || (authTokens[0] != "Bearer" && authTokens[0] != dpop.Scheme) {
 			logHandler.Error("failed to get beraer")
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
+			return
 		}
 
-		token, err := libJwt.VerifyToken(authTokens[1], "access")
+		claims, err := libJwt.VerifyAnyAudience(authTokens[1], libJwt.TypeAccess)
 		if err != nil {
-			logHandler.Error("failed to verify token")
+			logHandler.Error("failed to verify token", "error", err)
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		claims := token.Claims
-
-		jwtClaims, ok := claims.(jwt.MapClaims)
-		if !ok {
-			logHandler.Error("unexepted type of claims")
+		// привязанный токен закрывает сессию только с proof своего ключа, как в AuthMiddleware:
+		// иначе украденный DPoP токен позволил бы разлогинить владельца
+		if (claims.BoundKey() != "") != (authTokens[0] == dpop.Scheme) {
+			logHandler.Warn("token binding does not match authorization scheme", "scheme", authTokens[0])
 
+			c.Header("WWW-Authenticate", `DPoP error="invalid_token"`)
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		guid := jwtClaims["guid"].(string)
+		if claims.BoundKey() != "" {
+			proof, err := proofs.Verify(c.Request, authTokens[1], claims.BoundKey())
+			if err == nil {
+				err = proofs.Consume(proof, proof.JKT)
+			}
+
+			if err != nil {
+				logHandler.Warn("failed to verify dpop proof", "error", err.Error())
+
+				c.Header("WWW-Authenticate", `DPoP error="invalid_dpop_proof"`)
+				c.JSON(http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+		}
 
-		UserInfo, id, err := storage.FindByGUID(ctx, guid)
+		// парный refresh токен ищется по rti, а не по времени выдачи
+		refreshToken, err := storage.FindRefreshTokenByJTI(ctx, claims.RefreshTokenID)
 		if err != nil {
-			logHandler.Error("failed to find UserInfo", "error", err)
+			logHandler.Error("failed to find refresh token", "error", err)
 
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		IDstring := strconv.Itoa(id)
-
-		err = storage.BlockToken(ctx, UserInfo.TokenHash, IDstring)
-		if err != nil {
-			logHandler.Error("failed to block acc token", "error", err)
+		if refreshToken.SessionID != claims.SessionID {
+			logHandler.Error("not pair token", "filter", "sid")
 
-			c.JSON(http.StatusInternalServerError, "Internal error")
+			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		hashedAccessToken, err := libJwt.HashJWTbcrypt(token.Raw)
+		err = storage.BlockToken(ctx, refreshToken.TokenHash, refreshToken.SessionID)
 		if err != nil {
-			logHandler.Error("failed to hash access token", "error", err)
+			logHandler.Error("failed to block refresh token", "error", err)
 
 			c.JSON(http.StatusInternalServerError, "Internal error")
+			return
 		}
 
-		err = storage.BlockToken(ctx, hashedAccessToken, IDstring)
+		err = storage.BlockToken(ctx, libJwt.Fingerprint(authTokens[1]), refreshToken.SessionID)
 		if err != nil {
 			logHandler.Error("failed to block acc token", "error", err)
 
@@ -110,7 +134,7 @@ func New(log *slog.Logger, storage Storage) gin.HandlerFunc {
 			return
 		}
 
-		err = storage.Logout(ctx, guid)
+		err = storage.RevokeSession(ctx, refreshToken.SessionID)
 		if err != nil {
 			logHandler.Error("failed to logout", "error", err)
 
@@ -119,6 +143,8 @@ func New(log *slog.Logger, storage Storage) gin.HandlerFunc {
 			return
 		}
 
+		revocations.Forget(refreshToken.SessionID)
+
 		c.JSON(http.StatusOK, response.OK())
 
 	}
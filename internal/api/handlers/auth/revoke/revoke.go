@@ -0,0 +1,215 @@
+package revoke
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"medods-test/internal/api/middlewares/client"
+	"medods-test/internal/lib/api/response"
+	libJwt "medods-test/internal/lib/jwt"
+	"medods-test/internal/models"
+	"medods-test/internal/storage"
+	"net/http"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	HintAccessToken  = "access_token"
+	HintRefreshToken = "refresh_token"
+)
+
+// errForeignToken - токен выпущен другому клиенту, отзывать его вызывающий не вправе (RFC 7009 2.1)
+var errForeignToken = errors.New("token was issued to another client")
+
+type Request struct {
+	Token         string `form:"token" validate:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+}
+
+type Storage interface {
+	FindRefreshTokenByJTI(ctx context.Context, jti string) (*models.RefreshToken, error)
+	FindSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error)
+	BlockToken(ctx context.Context, fingerprint string, sessionID string) error
+	RevokeSession(ctx context.Context, sessionID string) error
+}
+
+// Revocations - кеш проверки отзыва этого экземпляра. В api это revocation.Cache
+type Revocations interface {
+	Forget(sessionID string)
+}
+
+// @Summary Отзыв токена (RFC 7009)
+// @Description Отзывает access или refresh токен вместе с парным ему токеном.
+// @Description Отзыв refresh токена завершает сессию, поэтому выданные по нему access токены тоже перестают приниматься.
+// @Description По RFC ответ 200 возвращается и для невалидных/уже отозванных токенов.
+// @Description Клиент аутентифицируется (HTTP Basic или client_id публичного клиента) и может отозвать только выданные ему токены
+// @Tags Auth
+// @Security BasicAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Отзываемый токен"
+// @Param token_type_hint formData string false "access_token или refresh_token"
+// @Success 200 {object} response.Response "Токен отозван"
+// @Failure 400 {object} response.Response "Невалидные входные данные"
+// @Failure 400 {object} response.OAuthError "Токен выпущен другому клиенту"
+// @Failure 401 {object} response.OAuthError "Клиент не аутентифицирован"
+// @Failure 500 {object} response.Response "Внутренняя ошибка сервера"
+// @Router /auth/revoke [post]
+func New(log *slog.Logger, storager Storage, revocations Revocations) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		issuer, ok := client.GetClient(c)
+		if !ok {
+			logHandler.Error("failed to get client from context")
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		logHandler = logHandler.With("clientID", issuer.ID)
+
+		var req Request
+
+		if err := c.ShouldBind(&req); err != nil {
+			logHandler.Error("failed to decode request body", "error", err.Error())
+
+			c.JSON(http.StatusBadRequest, response.Error("failed decode body"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			validatorErr := err.(validator.ValidationErrors)
+
+			logHandler.Error("invalid request", "err", err.Error())
+
+			c.JSON(http.StatusBadRequest, response.ValidationError(validatorErr))
+			return
+		}
+
+		// неизвестный hint по RFC игнорируется
+		revokers := []revoker{revokeAccess, revokeRefresh}
+		if req.TokenTypeHint == HintRefreshToken {
+			revokers = []revoker{revokeRefresh, revokeAccess}
+		}
+
+		for _, revoke := range revokers {
+			revoked, err := revoke(ctx, storager, revocations, issuer, req.Token)
+			if errors.Is(err, errForeignToken) {
+				logHandler.Warn("client tried to revoke a token of another client")
+
+				c.JSON(http.StatusBadRequest, response.OAuth(response.ErrUnauthorizedClient, err.Error()))
+				return
+			}
+
+			if err != nil {
+				logHandler.Error("failed to revoke token", "error", err)
+
+				c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+				return
+			}
+
+			if revoked {
+				logHandler.Info("token revoked")
+
+				c.JSON(http.StatusOK, response.OK())
+				return
+			}
+		}
+
+		logHandler.Info("unknown token, nothing to revoke")
+
+		c.JSON(http.StatusOK, response.OK())
+	}
+}
+
+// revoker возвращает false без ошибки, если токен не распознан как свой тип,
+// и errForeignToken, если токен выпущен не issuer. Отозвав токен, revoker сбрасывает
+// ответы кеша revocations по его сессии
+type revoker func(ctx context.Context, storager Storage, revocations Revocations, issuer *models.Client, token string) (bool, error)
+
+// issuedTo - токен или сессия с клиентом clientID принадлежат issuer. Сессии, открытые
+// до регистрации клиентов, без client_id - их может отозвать только доверенный клиент
+func issuedTo(clientID string, issuer *models.Client) bool {
+	return clientID == issuer.ID || (clientID == "" && issuer.Trusted)
+}
+
+// revokeAccess блокирует валидный access токен и, если он найден, парный ему refresh токен из claim rti.
+// Сам предъявленный токен блокируется всегда: пары может не быть (сервисный токен,
+// token-exchange) или она уже заменена
+func revokeAccess(ctx context.Context, storager Storage, revocations Revocations, issuer *models.Client, token string) (bool, error) {
+	claims, err := libJwt.VerifyAnyAudience(token, libJwt.TypeAccess)
+	if err != nil {
+		return false, nil
+	}
+
+	if !issuedTo(claims.ClientID, issuer) {
+		return false, errForeignToken
+	}
+
+	if err := storager.BlockToken(ctx, libJwt.Fingerprint(token), claims.SessionID); err != nil {
+		return false, err
+	}
+
+	revocations.Forget(claims.SessionID)
+
+	// сессию обмененный токен не закрывает: она принадлежит пользователю
+	if claims.IsService() || claims.RefreshTokenID == "" {
+		return true, nil
+	}
+
+	refreshToken, err := storager.FindRefreshTokenByJTI(ctx, claims.RefreshTokenID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	if refreshToken.SessionID != claims.SessionID {
+		return true, nil
+	}
+
+	if err := storager.BlockToken(ctx, refreshToken.TokenHash, refreshToken.SessionID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// revokeRefresh блокирует refresh токен и закрывает его сессию:
+// выданные по ней access токены перестают проходить проверку активности
+func revokeRefresh(ctx context.Context, storager Storage, revocations Revocations, issuer *models.Client, token string) (bool, error) {
+	tokenHash := libJwt.Fingerprint(token)
+
+	session, err := storager.FindSessionByTokenHash(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !issuedTo(session.ClientID, issuer) {
+		return false, errForeignToken
+	}
+
+	if err := storager.BlockToken(ctx, tokenHash, session.ID); err != nil {
+		return false, err
+	}
+
+	if err := storager.RevokeSession(ctx, session.ID); err != nil {
+		return false, err
+	}
+
+	revocations.Forget(session.ID)
+
+	return true, nil
+}
@@ -2,57 +2,96 @@ package refresh
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"log/slog"
-	"math"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
+	"medods-test/internal/api/middlewares/client"
 	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/device"
+	"medods-test/internal/lib/dpop"
 	libJwt "medods-test/internal/lib/jwt"
+	"medods-test/internal/lib/scope"
 	"medods-test/internal/models"
+	"medods-test/internal/services/hasher"
 	"medods-test/internal/storage"
 
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
 )
 
 type Response struct {
 	Resp        response.Response `json:"response"`
 	AccessToken string            `json:"accessToken"`
+	TokenType   string            `json:"tokenType"`
+	IDToken     string            `json:"idToken,omitempty"`
+	// RefreshToken - новый refresh токен для клиентов без cookie, браузер получает его в cookie
+	RefreshToken string `json:"refreshToken,omitempty"`
 }
 
+const EventRefreshTokenReuse = "refresh_token_reuse"
+
 var (
 	liveAccess  = time.Hour * 24     // 1 day
 	liveRefresh = time.Hour * 24 * 7 // 1 week
+	liveID      = time.Hour
 )
 
+// Config - настройки обмена refresh токена
+type Config struct {
+	// AccessLeeway - сколько после истечения access токен еще принимается
+	AccessLeeway time.Duration
+	// Grace - сколько после ротации refresh токен возвращает уже выданного преемника
+	Grace time.Duration
+}
+
 type Storage interface {
-	FindByGUID(ctx context.Context, guid string) (*models.UserInfo, int, error)
-	UpdateUserInfo(ctx context.Context, UserInfo *models.UserInfo) error
-	BlockToken(ctx context.Context, hashedToken string, idToken string) error
-	IsBlocked(ctx context.Context, hashedToken string) (bool, error)
+	FindRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	RotateSession(ctx context.Context, rotation *models.Rotation) error
+	RevokeSession(ctx context.Context, sessionID string) error
+	FindSession(ctx context.Context, sessionID string) (*models.Session, error)
+	UserPermissions(ctx context.Context, guid string) (*models.Permissions, error)
+	IsBlocked(ctx context.Context, fingerprint string) (bool, error)
+}
+
+type Hasher interface {
+	Hash(ctx context.Context, value string) (string, error)
+	Compare(ctx context.Context, hash string, value string) (bool, error)
+}
+
+// Proofs проверяет DPoP proof запроса. В api это dpop.Verifier
+type Proofs interface {
+	Verify(r *http.Request, accessToken string, jkt string) (*dpop.Proof, error)
+	Consume(proof *dpop.Proof, partition string) error
 }
 
 // RefreshToken godoc
 // @Summary Обновление пары JWT токенов
-// @Description Проверяет валидность access и refresh токенов, их соответствие, отсутствие в черном списке. Выдает новую пару токенов, добавляет старые в черный список и обновляет данные пользователя.
-// @Description Refresh token читается из cookie "Cookie:refreshToken="
+// @Description Проверяет валидность access и refresh токенов, их принадлежность одной сессии, отсутствие в черном списке. Выдает новую пару токенов, добавляет старые в черный список и обновляет сессию.
+// @Description Refresh token читается из cookie "Cookie:refreshToken=", а у клиентов без cookie (device flow) - из поля формы refresh_token;
+// @Description новый refresh токен возвращается тем же способом
+// @Description Access токен может быть уже истекшим - в пределах REFRESH_ACCESS_LEEWAY.
+// @Description Параллельные запросы с одним refresh токеном в пределах REFRESH_GRACE получают одну и ту же новую пару
+// @Description Для сессии со scope openid вместе с access токеном выдается новый ID токен (без nonce)
+// @Description Пара, привязанная к ключу DPoP, обновляется только с proof этого ключа (заголовок DPoP, схема Authorization DPoP);
+// @Description proof к непривязанной паре привязывает новую пару к ключу
+// @Description Клиент аутентифицируется (HTTP Basic или client_id публичного клиента) и обновляет только сессии, открытые для него
 // @Tags Refresh tokens
+// @Security BasicAuth
 // @Accept json
 // @Produce json
-// @Param Authorization header string true "Access токен в формате 'Bearer <token>'"
+// @Param Authorization header string true "Access токен в формате 'Bearer <token>' или 'DPoP <token>'"
+// @Param DPoP header string false "DPoP proof: htm POST, htu - адрес /auth/refresh"
 // @Success 200 {object} Response "Успешное обновление токенов"
-// @Failure 400 {object} response.Response "Некорректный запрос (например, GUID уже существует)"
 // @Failure 401 {string} string "Неавторизован (невалидные токены, токены в черном списке и т.д.)"
+// @Failure 401 {object} response.OAuthError "Клиент не аутентифицирован"
 // @Failure 500 {object} response.Response "Внутренняя ошибка сервера"
-// @Router /refresh [post]
-func New(log *slog.Logger, storager Storage) gin.HandlerFunc {
+// @Failure 503 {object} response.Response "Сервис перегружен, повторить после Retry-After"
+// @Router /auth/refresh [post]
+func New(log *slog.Logger, storager Storage, hashPool Hasher, cfg Config, proofs Proofs) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// проверить не в блек листе ли Рефреш токен
 		ctx := c.Request.Context()
@@ -61,6 +100,16 @@ func New(log *slog.Logger, storager Storage) gin.HandlerFunc {
 			"requestID", requestid.Get(c),
 		)
 
+		issuer, ok := client.GetClient(c)
+		if !ok {
+			logHandler.Error("failed to get client from context")
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		logHandler = logHandler.With("clientID", issuer.ID)
+
 		//получили и проверили подпись токена
 		authHeader := c.Request.Header.Get("Authorization")
 		if authHeader == "" {
@@ -72,122 +121,150 @@ func New(log *slog.Logger, storager Storage) gin.HandlerFunc {
 
 		authTokens := strings.Split(authHeader, " ")
 
-		if len(authTokens) != 2 || authTokens[0] != "Bearer" {
+		if len(authTokens) != 2 || (authTokens[0] != "Bearer" && authTokens[0] != dpop.Scheme) {
 			logHandler.Error("failed to get beraer")
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
+			return
 		}
 
-		blocked, err := storager.IsBlocked(ctx, authTokens[1])
-		if err != nil {
-			logHandler.Error("failed to check blocked token", "error", err)
+		accessHash := libJwt.Fingerprint(authTokens[1])
 
+		// истекший access принимается: его пара с refresh токеном проверяется по sid и rti
+		accessClaims, err := libJwt.VerifyExpiredToken(authTokens[1], libJwt.TypeAccess, cfg.AccessLeeway)
+		if err != nil {
+			logHandler.Error("failed to verify access token", "error", err)
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		if blocked {
-			logHandler.Error("token in blacklist", "error", err)
+		guidAccess := accessClaims.Subject
+
+		// привязанную к ключу пару можно обновить только с proof того же ключа,
+		// иначе украденные токены обновлялись бы без ключа. Непривязанная пара
+		// привязывается к ключу, если клиент прислал proof. jti proof запоминается
+		// позже, когда пара токенов уже проверена
+		jkt := accessClaims.BoundKey()
+
+		proof, err := proofs.Verify(c.Request, "", jkt)
+		switch {
+		case err == nil:
+			jkt = proof.JKT
+		case jkt != "" || !errors.Is(err, dpop.ErrNoProof):
+			logHandler.Warn("failed to verify dpop proof", "error", err.Error())
 
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		accessToken, err := libJwt.VerifyToken(authTokens[1], "access")
+		refreshToken, err := c.Cookie("refreshToken")
 		if err != nil {
-			logHandler.Error("failed to verify access token")
-			c.JSON(http.StatusUnauthorized, "Unauthorized")
-			return
+			refreshToken = c.PostForm("refresh_token")
 		}
 
-		AccessClaims := accessToken.Claims
-
-		jwtClaims, ok := AccessClaims.(jwt.MapClaims)
-		if !ok {
-			logHandler.Error("unexepted type of claims")
+		if refreshToken == "" {
+			logHandler.Error("failed to get refresh token from cookie or form")
 
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		guidAccess := jwtClaims["guid"].(string)
-		createdAtAccess := jwtClaims["created_at"].(float64)
+		refreshHash := libJwt.Fingerprint(refreshToken)
 
-		EncodedRefreshToken, err := c.Cookie("refreshToken")
+		tokenLink, err := storager.FindRefreshToken(ctx, refreshHash)
 		if err != nil {
-			logHandler.Error("failed to get refresh token from cookie", "error", err)
+			logHandler.Error("failed to find refresh token", "error", err)
 
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		DecodedRefreshToken, err := base64.StdEncoding.DecodeString(EncodedRefreshToken)
-		if err != nil {
-			logHandler.Error("failed to get decode refresh token", "error", err)
+		if tokenLink.SessionRevokedAt != nil {
+			logHandler.Error("session is revoked", "session", tokenLink.SessionID)
 
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		blocked, err = storager.IsBlocked(ctx, string(DecodedRefreshToken))
-		if err != nil {
-			logHandler.Error("failed to check blocked token", "error", err)
+		// токен уже обменяли на новый. В пределах grace это параллельный запрос
+		// того же клиента (например, вторая вкладка), иначе им пользуется кто-то еще
+		rotated := tokenLink.RotatedAt != nil
+		if rotated && !withinGrace(tokenLink, accessClaims, cfg.Grace) {
+			reuseDetected(ctx, logHandler, storager, tokenLink, c.ClientIP())
 
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		if blocked {
-			logHandler.Error("refresh token in blacklist", "error", err)
+		session, err := storager.FindSession(ctx, tokenLink.SessionID)
+		if err != nil {
+			logHandler.Error("failed to find session", "error", err)
 
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		refreshToken, err := libJwt.VerifyToken(string(DecodedRefreshToken), "refresh")
-		if err != nil {
-			logHandler.Error("failed to verify refresh token", "error", err)
+		if !session.IsActive || time.Now().After(session.ExpiresAt) {
+			logHandler.Error("refresh token is expired or session is closed")
+
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		RefreshClaims := refreshToken.Claims
-
-		jwtClaims, ok = RefreshClaims.(jwt.MapClaims)
-		if !ok {
-			logHandler.Error("unexepted type of claims")
+		// новая пара несет client_id сессии, поэтому обновить ее может только тот клиент,
+		// для которого она открыта. Сессии без клиента (до регистрации клиентов) - только доверенный
+		if session.ClientID != issuer.ID && (session.ClientID != "" || !issuer.Trusted) {
+			logHandler.Warn("session was opened for another client", "sessionClientID", session.ClientID)
 
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		guidRefresh := jwtClaims["guid"].(string)
-		createdAtRefresh := jwtClaims["created_at"].(float64)
+		// при ротации старая пара уходит в черный список, поэтому для
+		// замененного в пределах grace токена эта проверка не нужна
+		if !rotated {
+			for _, fingerprint := range []string{accessHash, refreshHash} {
+				blocked, err := storager.IsBlocked(ctx, fingerprint)
+				if err != nil {
+					logHandler.Error("failed to check blocked token", "error", err)
 
-		// достать guid из обоих токенов сравнить их
-		if guidAccess != guidRefresh {
-			logHandler.Error("not pair token", "filter", "guid")
+					c.JSON(http.StatusUnauthorized, "Unauthorized")
+					return
+				}
+
+				if blocked {
+					logHandler.Error("token in blacklist")
+
+					c.JSON(http.StatusUnauthorized, "Unauthorized")
+					return
+				}
+			}
+		}
+
+		// оба токена должны относиться к одной сессии
+		if guidAccess != session.GUID || accessClaims.SessionID != session.ID {
+			logHandler.Error("not pair token", "filter", "sid")
 
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
-		// Проверить что они были созданы в одно время
-		if !EqualWithinOneMinute(createdAtAccess, createdAtRefresh) {
-			logHandler.Error("not pair token", "filter", "created_at")
+
+		// access должен быть выдан вместе с предъявленным refresh токеном
+		if accessClaims.RefreshTokenID != tokenLink.JTI {
+			logHandler.Error("not pair token", "filter", "rti")
 
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		UserInfo, id, err := storager.FindByGUID(ctx, guidAccess)
+		sameUserAgent, err := hashPool.Compare(ctx, session.UserAgentHash, c.Request.UserAgent())
 		if err != nil {
-			logHandler.Error("failed to get guid", "error", err.Error())
+			logHandler.Error("failed to compare user agent", "error", err.Error())
 
-			c.JSON(http.StatusUnauthorized, "Unauthorized")
+			hashError(c, err)
 			return
 		}
 
-		err = bcrypt.CompareHashAndPassword([]byte(UserInfo.UserAgentHash), []byte(c.Request.UserAgent()))
-		if err != nil {
+		if !sameUserAgent {
 			log.Error("Different User Agnet")
 
 			log.Info("LOGOUTED")
@@ -195,54 +272,66 @@ func New(log *slog.Logger, storager Storage) gin.HandlerFunc {
 			return
 		}
 
-		err = bcrypt.CompareHashAndPassword([]byte(UserInfo.IPhash), []byte(c.ClientIP()))
+		sameIP, err := hashPool.Compare(ctx, session.IPhash, c.ClientIP())
 		if err != nil {
-			log.Warn("Different IP")
-
-			go webHook(logHandler, c.ClientIP())
+			logHandler.Error("failed to compare IP", "error", err.Error())
 
+			hashError(c, err)
+			return
 		}
 
-		idString := strconv.Itoa(id)
-
-		err = storager.BlockToken(ctx, refreshToken.Raw, idString)
-		if err != nil {
-			log.Error("failed to block refresh token", "error", err)
-
-			c.JSON(http.StatusInternalServerError, response.Error("Internal Error"))
-		}
+		if !sameIP {
+			log.Warn("Different IP")
 
-		err = storager.BlockToken(ctx, accessToken.Raw, idString)
-		if err != nil {
-			log.Error("failed to block access token", "error", err)
+			go webHook(logHandler, DefMessage+c.ClientIP())
 
-			c.JSON(http.StatusInternalServerError, response.Error("Internal Error"))
 		}
 
-		// ВЫДАЧА НОВЫХ ТОКЕНОВ
-		accToken, err := libJwt.NewAccessToken(guidAccess, liveAccess)
+		// роли перечитываются при каждом обмене: если роль забрали,
+		// ее scopes пропадают из следующего access токена
+		permissions, err := storager.UserPermissions(ctx, session.GUID)
 		if err != nil {
-			logHandler.Error("failed to generate jwt", "error", err.Error())
-
-			logHandler.Debug("debug", "guid", guidAccess)
+			logHandler.Error("failed to get user permissions", "error", err.Error())
 
 			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
 			return
 		}
 
-		refToken, err := libJwt.NewRefreshToken(guidAccess, liveRefresh)
-		if err != nil {
-			logHandler.Error("failed to generate jwt", "error", err.Error())
+		// новый access выпускается для того же сервиса, что и предыдущий
+		grant := libJwt.Grant{
+			Audience:  accessClaims.Audience,
+			JKT:       jkt,
+			Subject:   session.GUID,
+			SessionID: session.ID,
+			Scopes:    scope.Intersect(scope.Parse(session.Scope), permissions.Scopes),
+			Roles:     permissions.Roles,
+			ClientID:  session.ClientID,
+		}
 
-			logHandler.Debug("debug", "guid", guidAccess)
+		authTime := session.AuthTime
 
-			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		if proof != nil {
+			if err := proofs.Consume(proof, proof.JKT); err != nil {
+				logHandler.Warn("dpop proof rejected", "error", err.Error())
+
+				c.JSON(http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+		}
+
+		if rotated {
+			issueSuccessor(c, logHandler, storager, tokenLink, refreshToken, grant, authTime)
 			return
 		}
 
-		hashedRefToken, err := libJwt.HashJWTbcrypt(refToken) // рефреш токен сначала сжимается до 64 байт чтобы затем захешировать его в bcrypt (ограничение 72 байта)
+		// ВЫДАЧА НОВЫХ ТОКЕНОВ
+		refreshJTI := uuid.NewString()
+
+		grant.RefreshTokenID = refreshJTI
+
+		accToken, err := libJwt.NewAccessToken(grant, liveAccess)
 		if err != nil {
-			logHandler.Error("failed to hash refresh token", "error", err.Error())
+			logHandler.Error("failed to generate jwt", "error", err.Error())
 
 			logHandler.Debug("debug", "guid", guidAccess)
 
@@ -250,45 +339,77 @@ func New(log *slog.Logger, storager Storage) gin.HandlerFunc {
 			return
 		}
 
-		hashedUserAgent, err := bcrypt.GenerateFromPassword([]byte(c.Request.UserAgent()), bcrypt.DefaultCost)
+		// ID токен при обновлении - без nonce (OpenID Connect Core 12.2)
+		idToken, err := libJwt.IDTokenFor(grant, "", authTime, liveID)
 		if err != nil {
-			logHandler.Error("failed to hash user agent", "error", err.Error())
-
-			logHandler.Debug("debug", "guid", guidAccess)
+			logHandler.Error("failed to generate id token", "error", err.Error())
 
 			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
 			return
 		}
 
-		hashedIP, err := bcrypt.GenerateFromPassword([]byte(c.ClientIP()), bcrypt.DefaultCost)
-		if err != nil {
-			logHandler.Error("failed to hash user agent", "error", err.Error())
+		refToken := libJwt.SuccessorRefreshToken(refreshToken)
 
-			logHandler.Debug("debug", "guid", guidAccess)
+		// User-Agent совпал, поэтому его хеш остается прежним. IP хешируется заново,
+		// только если он сменился
+		hashedIP := session.IPhash
+		if !sameIP {
+			hashedIP, err = hashPool.Hash(ctx, c.ClientIP())
+			if err != nil {
+				logHandler.Error("failed to hash IP", "error", err.Error())
 
-			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
-			return
+				logHandler.Debug("debug", "guid", guidAccess)
+
+				hashError(c, err)
+				return
+			}
 		}
 
-		UserInfo = &models.UserInfo{
+		session = &models.Session{
+			ID:            session.ID,
 			GUID:          guidAccess,
-			UserAgentHash: string(hashedUserAgent),
-			IPhash:        string(hashedIP),
-			TokenHash:     hashedRefToken,
+			UserAgentHash: session.UserAgentHash,
+			IPhash:        hashedIP,
+			Device:        device.Describe(c.Request.UserAgent()),
+			Location:      device.Location(c.ClientIP()),
+			ClientID:      session.ClientID,
+			AuthTime:      authTime,
+			TokenHash:     libJwt.Fingerprint(refToken),
+			ExpiresAt:     time.Now().Add(liveRefresh),
 		}
 
-		if err := storager.UpdateUserInfo(ctx, UserInfo); err != nil {
-			if errors.Is(err, storage.ErrGuidExists) {
-				logHandler.Error(err.Error())
+		// старые токены блокируются, refresh заменяется и сессия обновляется
+		// одной транзакцией: либо все, либо ничего
+		rotation := &models.Rotation{
+			Parent:     tokenLink,
+			Session:    session,
+			RefreshJTI: refreshJTI,
+			JKT:        grant.JKT,
+			Blocked:    []string{refreshHash, accessHash},
+		}
 
-				logHandler.Debug("debug", "guid", guidAccess)
+		if err := storager.RotateSession(ctx, rotation); err != nil {
+			// параллельный запрос с тем же токеном успел раньше
+			if errors.Is(err, storage.ErrTokenReused) {
+				if cfg.Grace > 0 {
+					issueSuccessor(c, logHandler, storager, tokenLink, refreshToken, grant, authTime)
+					return
+				}
 
-				c.JSON(http.StatusBadRequest, response.Error("GUID is already exists"))
+				reuseDetected(ctx, logHandler, storager, tokenLink, c.ClientIP())
 
+				c.JSON(http.StatusUnauthorized, "Unauthorized")
 				return
+			}
 
+			if errors.Is(err, storage.ErrSessionNotFound) {
+				logHandler.Error("session was closed during refresh", "session", session.ID)
+
+				c.JSON(http.StatusUnauthorized, "Unauthorized")
+				return
 			}
-			logHandler.Error("failed to save hash User Info", "error", err.Error())
+
+			logHandler.Error("failed to rotate session", "error", err.Error())
 
 			logHandler.Debug("debug", "guid", guidAccess)
 
@@ -296,16 +417,7 @@ func New(log *slog.Logger, storager Storage) gin.HandlerFunc {
 			return
 		}
 
-		c.SetCookie(
-			"refreshToken", base64.URLEncoding.EncodeToString([]byte(refToken)),
-			int(liveRefresh.Seconds()),
-			"/",
-			"localhost",
-			false,
-			true,
-		)
-
-		c.JSON(http.StatusOK, Response{Resp: response.OK(), AccessToken: accToken})
+		respond(c, Response{Resp: response.OK(), AccessToken: accToken, TokenType: dpop.TokenType(grant.JKT), IDToken: idToken}, refToken)
 
 		// Проверить Юзер Агент. Если неверно = дееавторизовать
 
@@ -319,7 +431,114 @@ func New(log *slog.Logger, storager Storage) gin.HandlerFunc {
 	}
 }
 
-func EqualWithinOneMinute(t1, t2 float64) bool {
-	diff := math.Abs(t1 - t2)
-	return diff <= 60.0 // 1 минута = 60 секунд
+// withinGrace - замененный refresh токен предъявлен вместе со своим access токеном
+// не позже чем через grace после ротации
+func withinGrace(token *models.RefreshToken, accessClaims *libJwt.Claims, grace time.Duration) bool {
+	return grace > 0 &&
+		time.Since(*token.RotatedAt) <= grace &&
+		accessClaims.RefreshTokenID == token.JTI
+}
+
+// issueSuccessor отвечает на повторный обмен уже замененного refresh токена: клиент
+// получает того же преемника, что и выигравший гонку запрос, и новый access к нему
+func issueSuccessor(c *gin.Context, log *slog.Logger, storager Storage, parent *models.RefreshToken, parentToken string, grant libJwt.Grant, authTime time.Time) {
+	ctx := c.Request.Context()
+
+	successorToken := libJwt.SuccessorRefreshToken(parentToken)
+
+	successor, err := storager.FindRefreshToken(ctx, libJwt.Fingerprint(successorToken))
+	if err != nil {
+		log.Error("failed to find successor refresh token", "error", err)
+
+		c.JSON(http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// преемника уже тоже обменяли - это не гонка двух вкладок
+	if successor.ParentID == nil || *successor.ParentID != parent.ID || successor.RotatedAt != nil {
+		reuseDetected(ctx, log, storager, parent, c.ClientIP())
+
+		c.JSON(http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// преемник остается привязан к ключу выигравшего запроса: повтор с другим
+	// ключом или без DPoP не получает access к нему
+	if grant.JKT != successor.JKT {
+		log.Warn("successor refresh token is bound to another key", "session", parent.SessionID)
+
+		c.JSON(http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	grant.RefreshTokenID = successor.JTI
+
+	accToken, err := libJwt.NewAccessToken(grant, liveAccess)
+	if err != nil {
+		log.Error("failed to generate jwt", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return
+	}
+
+	idToken, err := libJwt.IDTokenFor(grant, "", authTime, liveID)
+	if err != nil {
+		log.Error("failed to generate id token", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return
+	}
+
+	log.Info("refresh token rotated concurrently, returning successor", "session", parent.SessionID)
+
+	respond(c, Response{Resp: response.OK(), AccessToken: accToken, TokenType: dpop.TokenType(grant.JKT), IDToken: idToken}, successorToken)
+}
+
+// respond отдает новый refresh токен тем же способом, каким пришел старый:
+// браузеру - в cookie, клиенту без cookie - в теле ответа
+func respond(c *gin.Context, resp Response, refreshToken string) {
+	if _, err := c.Cookie("refreshToken"); err == nil {
+		setRefreshCookie(c, refreshToken)
+	} else {
+		resp.RefreshToken = refreshToken
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func setRefreshCookie(c *gin.Context, refreshToken string) {
+	c.SetCookie(
+		"refreshToken", refreshToken,
+		int(liveRefresh.Seconds()),
+		"/",
+		"localhost",
+		false,
+		true,
+	)
+}
+
+// hashError отвечает 503, если пул хеширования перегружен, и 500 в остальных случаях
+func hashError(c *gin.Context, err error) {
+	if errors.Is(err, hasher.ErrSaturated) {
+		response.Overloaded(c, hasher.RetryAfter)
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+}
+
+// reuseDetected отзывает сессию, в семействе которой повторно предъявили уже замененный refresh токен
+func reuseDetected(ctx context.Context, log *slog.Logger, storager Storage, token *models.RefreshToken, IP string) {
+	log.Warn("security event",
+		"event", EventRefreshTokenReuse,
+		"session", token.SessionID,
+		"guid", token.GUID,
+		"ip", IP,
+	)
+
+	if err := storager.RevokeSession(ctx, token.SessionID); err != nil {
+		log.Error("failed to revoke session", "session", token.SessionID, "error", err)
+	}
+
+	go webHook(log, ReuseMessage+token.GUID)
 }
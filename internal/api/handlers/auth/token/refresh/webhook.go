@@ -14,12 +14,15 @@ type Request struct {
 
 var WebHookIP = os.Getenv("WEB_HOOK")
 
-const DefMessage = "Попытка зайти с неизвенстного IP: "
+const (
+	DefMessage   = "Попытка зайти с неизвенстного IP: "
+	ReuseMessage = "Повторно использован refresh токен, все токены сессии отозваны. GUID: "
+)
 
-func webHook(log *slog.Logger, IP string) {
+func webHook(log *slog.Logger, message string) {
 	client := http.Client{}
 
-	reqStruct := Request{Message: DefMessage + IP}
+	reqStruct := Request{Message: message}
 
 	jsonData, err := json.Marshal(reqStruct)
 	if err != nil {
@@ -0,0 +1,118 @@
+package tokens
+
+import (
+	"errors"
+	"log/slog"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/jwt"
+	"medods-test/internal/lib/pkce"
+	"medods-test/internal/lib/scope"
+	"medods-test/internal/models"
+	"medods-test/internal/storage"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type AuthorizationCodeRequest struct {
+	Code         string `json:"code" form:"code" validate:"required"`
+	RedirectURI  string `json:"redirect_uri" form:"redirect_uri" validate:"required"`
+	CodeVerifier string `json:"code_verifier" form:"code_verifier" validate:"required"`
+}
+
+// exchangeCode меняет код из /authorize на сессию пользователя (RFC 6749 4.1.3, RFC 7636 4.6).
+// Код одноразовый: он помечается использованным до проверок, поэтому неудачная попытка
+// с чужим verifier тоже сжигает код
+func exchangeCode(c *gin.Context, logHandler *slog.Logger, storager Storage, hashPool Hasher, issuer *models.Client, target issuance) {
+	ctx := c.Request.Context()
+
+	var req AuthorizationCodeRequest
+
+	if err := bind(c, &req); err != nil {
+		logHandler.Error("failed to decode request body", "error", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidRequest, "failed decode body"))
+		return
+	}
+
+	if err := validator.New().Struct(req); err != nil {
+		logHandler.Info("invalid request", "err", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidRequest, "code, redirect_uri and code_verifier are required"))
+		return
+	}
+
+	code, err := storager.ConsumeAuthorizationCode(ctx, jwt.Fingerprint(req.Code))
+	if err != nil {
+		if errors.Is(err, storage.ErrCodeNotFound) {
+			logHandler.Warn("authorization code is unknown or already used")
+
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidGrant, ""))
+			return
+		}
+
+		logHandler.Error("failed to consume authorization code", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return
+	}
+
+	switch {
+	case code.ClientID != issuer.ID:
+		logHandler.Warn("authorization code issued to another client", "codeClientID", code.ClientID)
+	case code.RedirectURI != req.RedirectURI:
+		logHandler.Warn("redirect_uri does not match authorization request")
+	case time.Now().After(code.ExpiresAt):
+		logHandler.Info("authorization code is expired")
+	case !pkce.Verify(req.CodeVerifier, code.CodeChallenge):
+		logHandler.Warn("code_verifier does not match code_challenge")
+	default:
+		issueCodeSession(c, logHandler, storager, hashPool, code, target)
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidGrant, ""))
+}
+
+func issueCodeSession(c *gin.Context, logHandler *slog.Logger, storager Storage, hashPool Hasher, code *models.AuthorizationCode, target issuance) {
+	permissions, err := storager.UserPermissions(c.Request.Context(), code.GUID)
+	if err != nil {
+		logHandler.Error("failed to get user permissions", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return
+	}
+
+	// роли могли поменяться, пока код ждал обмена
+	scopes := scope.Intersect(scope.Parse(code.Scope), permissions.Scopes)
+
+	if !target.consumeProof(c, logHandler) {
+		return
+	}
+
+	pair, ok := openSession(c, logHandler, storager, hashPool, jwt.Grant{
+		Audience: target.Audience,
+		JKT:      target.JKT,
+		Subject:  code.GUID,
+		Scopes:   scopes,
+		Roles:    permissions.Roles,
+		ClientID: code.ClientID,
+	}, authentication{Time: code.AuthTime, Nonce: code.Nonce})
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+
+	// клиент по коду может не иметь доступа к cookie домена сервера, поэтому refresh токен - в теле (RFC 6749 5.1)
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    target.TokenType(),
+		ExpiresIn:    int64(liveAccess.Seconds()),
+		Scope:        scope.Join(scopes),
+		IDToken:      pair.IDToken,
+		RefreshToken: pair.RefreshToken,
+	})
+}
@@ -0,0 +1,73 @@
+package tokens
+
+import (
+	"log/slog"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/jwt"
+	"medods-test/internal/lib/scope"
+	"medods-test/internal/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ClientCredentialsRequest struct {
+	// Scope - запрошенные scopes через пробел. Пусто - все, что разрешены клиенту
+	Scope string `json:"scope" form:"scope"`
+}
+
+// issueServiceToken выдает клиенту access токен на самого себя (RFC 6749 4.4).
+// Сессии, refresh токена и cookie нет: токен короткоживущий, за новым клиент приходит сам
+func issueServiceToken(c *gin.Context, logHandler *slog.Logger, issuer *models.Client, target issuance) {
+	var req ClientCredentialsRequest
+
+	if err := bind(c, &req); err != nil {
+		logHandler.Error("failed to decode request body", "error", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidRequest, "failed decode body"))
+		return
+	}
+
+	allowed := scope.Parse(issuer.Scope)
+	if len(allowed) == 0 {
+		logHandler.Info("client has no service scopes")
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrUnauthorizedClient, "client is not allowed to use client_credentials"))
+		return
+	}
+
+	scopes, err := scope.Narrow(scope.Parse(req.Scope), allowed)
+	if err != nil {
+		logHandler.Info("requested scope is not allowed", "error", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidScope, err.Error()))
+		return
+	}
+
+	if !target.consumeProof(c, logHandler) {
+		return
+	}
+
+	accToken, err := jwt.NewAccessToken(jwt.Grant{
+		Audience: target.Audience,
+		JKT:      target.JKT,
+		Subject:  issuer.ID,
+		Scopes:   scopes,
+		ClientID: issuer.ID,
+	}, liveServiceAccess)
+	if err != nil {
+		logHandler.Error("failed to generate jwt", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken: accToken,
+		TokenType:   target.TokenType(),
+		ExpiresIn:   int64(liveServiceAccess.Seconds()),
+		Scope:       scope.Join(scopes),
+	})
+}
@@ -0,0 +1,156 @@
+package tokens
+
+import (
+	"errors"
+	"log/slog"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/jwt"
+	"medods-test/internal/lib/scope"
+	"medods-test/internal/models"
+	"medods-test/internal/storage"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// slowDownStep - на сколько растет интервал опроса после каждого slow_down (RFC 8628 3.5)
+const slowDownStep = time.Second * 5
+
+type DeviceCodeRequest struct {
+	DeviceCode string `json:"device_code" form:"device_code" validate:"required"`
+}
+
+// pollDevice отвечает на опрос устройства (RFC 8628 3.4, 3.5). Пока пользователь
+// не решил - authorization_pending, опрос чаще interval - slow_down, после которого interval
+// вырастает на 5 секунд для всех следующих опросов. Одобренный запрос
+// открывает сессию один раз, refresh токен уходит в теле: cookie устройству некуда положить
+func pollDevice(c *gin.Context, logHandler *slog.Logger, storager Storage, hashPool Hasher, issuer *models.Client, target issuance) {
+	ctx := c.Request.Context()
+
+	var req DeviceCodeRequest
+
+	if err := bind(c, &req); err != nil {
+		logHandler.Error("failed to decode request body", "error", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidRequest, "failed decode body"))
+		return
+	}
+
+	if err := validator.New().Struct(req); err != nil {
+		logHandler.Info("invalid request", "err", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidRequest, "device_code is required"))
+		return
+	}
+
+	deviceCodeHash := jwt.Fingerprint(req.DeviceCode)
+
+	code, err := storager.PollDeviceCode(ctx, deviceCodeHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			logHandler.Info("device code is unknown")
+
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidGrant, ""))
+			return
+		}
+
+		logHandler.Error("failed to poll device code", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return
+	}
+
+	if code.ClientID != issuer.ID {
+		logHandler.Warn("device code issued to another client", "codeClientID", code.ClientID)
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidGrant, ""))
+		return
+	}
+
+	if time.Now().After(code.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrExpiredToken, ""))
+		return
+	}
+
+	if code.LastPolledAt != nil && time.Since(*code.LastPolledAt) < code.Interval {
+		if err := storager.SlowDownDeviceCode(ctx, deviceCodeHash, slowDownStep); err != nil {
+			logHandler.Error("failed to slow down device code", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrSlowDown, ""))
+		return
+	}
+
+	switch code.Status {
+	case models.DeviceCodePending:
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrAuthorizationPending, ""))
+		return
+	case models.DeviceCodeDenied:
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrAccessDenied, ""))
+		return
+	case models.DeviceCodeApproved:
+		// одобрен - выдаем токены ниже
+	default:
+		logHandler.Warn("device code is already used")
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidGrant, ""))
+		return
+	}
+
+	code, err = storager.ConsumeDeviceCode(ctx, deviceCodeHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			logHandler.Warn("device code was consumed concurrently")
+
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidGrant, ""))
+			return
+		}
+
+		logHandler.Error("failed to consume device code", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return
+	}
+
+	permissions, err := storager.UserPermissions(ctx, code.GUID)
+	if err != nil {
+		logHandler.Error("failed to get user permissions", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return
+	}
+
+	scopes := scope.Intersect(scope.Parse(code.Scope), permissions.Scopes)
+
+	if !target.consumeProof(c, logHandler) {
+		return
+	}
+
+	pair, ok := openSession(c, logHandler, storager, hashPool, jwt.Grant{
+		Audience: target.Audience,
+		JKT:      target.JKT,
+		Subject:  code.GUID,
+		Scopes:   scopes,
+		Roles:    permissions.Roles,
+		ClientID: code.ClientID,
+	}, authentication{Time: code.AuthTime})
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    target.TokenType(),
+		ExpiresIn:    int64(liveAccess.Seconds()),
+		Scope:        scope.Join(scopes),
+		IDToken:      pair.IDToken,
+		RefreshToken: pair.RefreshToken,
+	})
+}
@@ -0,0 +1,122 @@
+package tokens
+
+import (
+	"log/slog"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/device"
+	"medods-test/internal/lib/jwt"
+	"medods-test/internal/lib/scope"
+	"medods-test/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// authentication - когда пользователь вошел и nonce запроса авторизации. Уходят в ID токен
+type authentication struct {
+	Time  time.Time
+	Nonce string
+}
+
+// issued - токены, выданные при открытии сессии. IDToken пустой без scope openid,
+// RefreshToken уже лежит в cookie и нужен только клиентам без cookie
+type issued struct {
+	AccessToken  string
+	IDToken      string
+	RefreshToken string
+}
+
+// openSession открывает сессию по grant, выпускает для нее access токен (и ID токен
+// при scope openid) и кладет refresh токен в cookie. SessionID и RefreshTokenID grant'а
+// заполняются здесь. При ошибке сама отвечает клиенту и возвращает false
+func openSession(c *gin.Context, logHandler *slog.Logger, storager Storage, hashPool Hasher, grant jwt.Grant, authn authentication) (*issued, bool) {
+	ctx := c.Request.Context()
+
+	if c.Request.UserAgent() == "" {
+		logHandler.Error("UserAgent from request is empty")
+
+		c.JSON(http.StatusBadRequest, response.Error("Bad request"))
+		return nil, false
+	}
+
+	if authn.Time.IsZero() {
+		authn.Time = time.Now()
+	}
+
+	grant.SessionID = uuid.NewString()
+	grant.RefreshTokenID = uuid.NewString()
+
+	accToken, err := jwt.NewAccessToken(grant, liveAccess)
+	if err != nil {
+		logHandler.Error("failed to generate jwt", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return nil, false
+	}
+
+	idToken, err := jwt.IDTokenFor(grant, authn.Nonce, authn.Time, liveID)
+	if err != nil {
+		logHandler.Error("failed to generate id token", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return nil, false
+	}
+
+	refToken, err := jwt.NewRefreshToken()
+	if err != nil {
+		logHandler.Error("failed to generate refresh token", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return nil, false
+	}
+
+	hashedUserAgent, err := hashPool.Hash(ctx, c.Request.UserAgent())
+	if err != nil {
+		logHandler.Error("failed to hash user agent", "error", err.Error())
+
+		hashError(c, err)
+		return nil, false
+	}
+
+	hashedIP, err := hashPool.Hash(ctx, c.ClientIP())
+	if err != nil {
+		logHandler.Error("failed to hash IP", "error", err.Error())
+
+		hashError(c, err)
+		return nil, false
+	}
+
+	session := &models.Session{
+		ID:            grant.SessionID,
+		GUID:          grant.Subject,
+		UserAgentHash: hashedUserAgent,
+		IPhash:        hashedIP,
+		Device:        device.Describe(c.Request.UserAgent()),
+		Location:      device.Location(c.ClientIP()),
+		Scope:         scope.Join(grant.Scopes),
+		ClientID:      grant.ClientID,
+		AuthTime:      authn.Time,
+		TokenHash:     jwt.Fingerprint(refToken),
+		ExpiresAt:     time.Now().Add(liveRefresh),
+	}
+
+	if err := storager.SaveSession(ctx, session, grant.RefreshTokenID, grant.JKT); err != nil {
+		logHandler.Error("failed to save session", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return nil, false
+	}
+
+	c.SetCookie(
+		"refreshToken", refToken,
+		int(liveRefresh.Seconds()),
+		"/",
+		"localhost",
+		false,
+		true,
+	)
+
+	return &issued{AccessToken: accToken, IDToken: idToken, RefreshToken: refToken}, true
+}
@@ -2,171 +2,277 @@ package tokens
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"log/slog"
+	"medods-test/internal/api/middlewares/client"
 	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/dpop"
 	"medods-test/internal/lib/jwt"
+	"medods-test/internal/lib/scope"
 	"medods-test/internal/models"
-	"medods-test/internal/storage"
+	"medods-test/internal/services/hasher"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/gin-gonic/gin/binding"
 )
 
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantAuthorizationCode = "authorization_code"
+	GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// GrantRequest - общее у всех запросов /auth/token. Пустой grant_type - исходный
+// поток выдачи токенов пользователю по GUID
+type GrantRequest struct {
+	GrantType string `json:"grant_type" form:"grant_type"`
+	// Resource - сервис, для которого нужен access токен (RFC 8707), один из audiences клиента
+	// или JWT_AUDIENCE. Пусто - аудитория клиента по умолчанию
+	Resource string `json:"resource" form:"resource"`
+}
+
 type Request struct {
-	GUID string `json:"guid" validate:"required,uuid"`
+	GUID string `json:"guid" form:"guid" validate:"required,uuid"`
+	// Scope - запрошенные scopes через пробел. Пусто - все, что разрешают роли пользователя
+	Scope string `json:"scope" form:"scope"`
 }
 
 type Response struct {
 	Resp        response.Response `json:"response"`
 	AccessToken string            `json:"accessToken"`
+	TokenType   string            `json:"tokenType"`
+	IDToken     string            `json:"idToken,omitempty"`
+	Scope       string            `json:"scope"`
+}
+
+// TokenResponse - ответ OAuth 2.0 grant'ов по RFC 6749 5.1
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	// IssuedTokenType - только у token-exchange, RFC 8693 2.2.1
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Scope           string `json:"scope,omitempty"`
+	IDToken         string `json:"id_token,omitempty"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
 }
 
 var (
-	liveAccess  = time.Hour * 24     // 1 day
-	liveRefresh = time.Hour * 24 * 7 // 1 week
+	liveAccess        = time.Hour * 24     // 1 day
+	liveRefresh       = time.Hour * 24 * 7 // 1 week
+	liveServiceAccess = time.Minute * 15
+	liveID            = time.Hour
+	liveExchanged     = time.Minute * 15
 )
 
-type Saver interface {
-	SaveUserInfo(ctx context.Context, UserInfo *models.UserInfo) (int, error)
+type Storage interface {
+	SaveSession(ctx context.Context, session *models.Session, refreshJTI string, jkt string) error
+	UserPermissions(ctx context.Context, guid string) (*models.Permissions, error)
+	ClientHasSubject(ctx context.Context, clientID string, guid string) (bool, error)
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error)
+	PollDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceCode, error)
+	SlowDownDeviceCode(ctx context.Context, deviceCodeHash string, step time.Duration) error
+	ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceCode, error)
+	CheckAccess(ctx context.Context, sessionID string, fingerprint string) (bool, error)
+	SaveTokenExchange(ctx context.Context, exchange *models.TokenExchange) error
+}
+
+type Hasher interface {
+	Hash(ctx context.Context, value string) (string, error)
+}
+
+// Proofs проверяет DPoP proof запроса. В api это dpop.Verifier
+type Proofs interface {
+	Verify(r *http.Request, accessToken string, jkt string) (*dpop.Proof, error)
+	Consume(proof *dpop.Proof, partition string) error
+}
+
+// issuance - общее для всех grant'ов: для какого сервиса выпускается access токен
+// и к какому ключу DPoP он привязан (пустой JKT - bearer токен)
+type issuance struct {
+	Audience string
+	JKT      string
+
+	proof    *dpop.Proof
+	proofs   Proofs
+	clientID string
+}
+
+func (t issuance) TokenType() string {
+	return dpop.TokenType(t.JKT)
+}
+
+// consumeProof отмечает DPoP proof использованным. Вызывается перед самой выдачей токена,
+// когда grant уже проверен: иначе любой, кто знает client_id публичного клиента,
+// забивал бы журнал jti proof'ами к заведомо неудачным запросам
+func (t issuance) consumeProof(c *gin.Context, logHandler *slog.Logger) bool {
+	if t.proof == nil {
+		return true
+	}
+
+	if err := t.proofs.Consume(t.proof, t.clientID); err != nil {
+		logHandler.Info("dpop proof rejected", "error", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidDPoPProof, err.Error()))
+		return false
+	}
+
+	return true
 }
 
 // @Summary Создание новых токенов
-// @Description Генерирует новую пару access и refresh токенов для пользователя
+// @Description Без grant_type открывает новую сессию пользователя и генерирует для нее пару access и refresh токенов.
+// @Description У одного GUID может быть несколько активных сессий.
+// @Description grant_type=client_credentials выдает клиенту короткоживущий сервисный access токен на себя, без refresh токена и cookie.
+// @Description grant_type=authorization_code меняет код из /authorize и code_verifier (PKCE) на сессию пользователя.
+// @Description grant_type=urn:ietf:params:oauth:grant-type:device_code - опрос устройства по device_code из /device_authorization;
+// @Description пока пользователь не подтвердил запрос - authorization_pending, при слишком частом опросе - slow_down.
+// @Description По authorization_code и device_code refresh токен приходит в теле ответа (refresh_token).
+// @Description grant_type=urn:ietf:params:oauth:grant-type:token-exchange (RFC 8693) выдает по access токену пользователя
+// @Description токен с более узким scope/audience и claim act: клиент или сотрудник из actor_token (scope impersonate) действует от имени пользователя.
+// @Description Публичный клиент передает только client_id в форме и может использовать только authorization_code и device_code.
+// @Description Со scope openid вместе с access токеном выдается ID токен OpenID Connect.
+// @Description Access токен выпускается для одного сервиса (aud): resource из запроса или аудитории клиента по умолчанию.
+// @Description С заголовком DPoP (proof по RFC 9449) токен привязывается к ключу клиента (cnf.jkt) и выдается с token_type DPoP.
+// @Description Клиент аутентифицируется по HTTP Basic (client_id и секрет) и должен иметь право выпускать токены для GUID
 // @Tags Auth
-// @Accept json
+// @Security BasicAuth
+// @Accept json,x-www-form-urlencoded
 // @Produce json
 // @Param request body Request true "Данные для генерации токенов"
+// @Param DPoP header string false "DPoP proof: htm POST, htu - адрес /auth/token"
+// @Param grant_type formData string false "client_credentials, authorization_code, urn:ietf:params:oauth:grant-type:device_code или urn:ietf:params:oauth:grant-type:token-exchange"
+// @Param code formData string false "Код из /authorize"
+// @Param redirect_uri formData string false "redirect_uri из запроса /authorize"
+// @Param code_verifier formData string false "PKCE code_verifier"
+// @Param device_code formData string false "device_code из /device_authorization"
+// @Param subject_token formData string false "Токен пользователя для token-exchange"
+// @Param subject_token_type formData string false "urn:ietf:params:oauth:token-type:access_token"
+// @Param actor_token formData string false "Токен сотрудника со scope impersonate"
+// @Param actor_token_type formData string false "urn:ietf:params:oauth:token-type:access_token"
+// @Param audience formData string false "Сервис, для которого нужен токен"
+// @Param scope formData string false "Запрошенные scopes через пробел"
+// @Param resource formData string false "Сервис (aud), для которого нужен access токен"
 // @Success 200 {object} Response "Успешная генерация токенов"
+// @Success 200 {object} TokenResponse "Токен по client_credentials, authorization_code, device_code или token-exchange"
 // @Success 200 {string} string "Set-Cookie: refreshToken={token}; Path=/; Domain=localhost; Max-Age={liveRefresh}; HttpOnly"
-// @Failure 400 {object} response.Response "Невалидные входные данные"
+// @Failure 400 {object} response.Response "Невалидные входные данные или scope, не разрешенный ролями"
+// @Failure 400 {object} response.OAuthError "Неизвестный grant_type или клиенту не разрешен GUID/scope"
+// @Failure 401 {object} response.OAuthError "Клиент не аутентифицирован"
 // @Failure 500 {object} response.Response "Внутренняя ошибка сервера"
+// @Failure 503 {object} response.Response "Сервис перегружен, повторить после Retry-After"
 // @Router /auth/token [post]
-func New(log *slog.Logger, saver Saver) gin.HandlerFunc {
+func New(log *slog.Logger, storager Storage, hashPool Hasher, proofs Proofs) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx := c.Request.Context()
-
 		logHandler := log.With(
 			"requestID", requestid.Get(c),
 		)
 
-		var req Request
-
-		if c.Request.UserAgent() == "" {
-			logHandler.Error("UserAgent from request is empty")
-
-			c.JSON(http.StatusBadRequest, response.Error("Bad request"))
-			return
-		}
-
-		if err := c.BindJSON(&req); err != nil {
-			logHandler.Error("failed to decode request body", "error", err.Error())
-
-			c.JSON(http.StatusBadRequest, response.Error("failed decode body"))
-			return
-		}
-
-		if err := validator.New().Struct(req); err != nil {
-			validatorErr := err.(validator.ValidationErrors)
-
-			logHandler.Error("invalid request", "err", err.Error())
-
-			c.JSON(http.StatusBadRequest, response.ValidationError(validatorErr))
-
-			return
-		}
-
-		accToken, err := jwt.NewAccessToken(req.GUID, liveAccess)
-		if err != nil {
-			logHandler.Error("failed to generate jwt", "error", err.Error())
-
-			logHandler.Debug("debug", "guid", req.GUID)
+		issuer, ok := client.GetClient(c)
+		if !ok {
+			logHandler.Error("failed to get client from context")
 
 			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
 			return
 		}
 
-		refToken, err := jwt.NewRefreshToken(req.GUID, liveRefresh)
-		if err != nil {
-			logHandler.Error("failed to generate jwt", "error", err.Error())
+		logHandler = logHandler.With("clientID", issuer.ID)
 
-			logHandler.Debug("debug", "guid", req.GUID)
+		var grant GrantRequest
 
-			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		if err := bind(c, &grant); err != nil {
+			logHandler.Error("failed to decode request body", "error", err.Error())
+
+			c.JSON(http.StatusBadRequest, response.Error("failed decode body"))
 			return
 		}
 
-		hashedRefToken, err := jwt.HashJWTbcrypt(refToken) // рефреш токен сначала сжимается до 64 байт чтобы затем захешировать его в bcrypt (ограничение 72 байта)
-		if err != nil {
-			logHandler.Error("failed to hash refresh token", "error", err.Error())
-
-			logHandler.Debug("debug", "guid", req.GUID)
+		// публичный клиент не доказал, кто он, поэтому выпускать токены по GUID или на себя ему нельзя
+		if issuer.Public && grant.GrantType != GrantAuthorizationCode && grant.GrantType != GrantDeviceCode {
+			logHandler.Info("grant type is not allowed for public client", "grantType", grant.GrantType)
 
-			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrUnauthorizedClient, "public clients may only use authorization_code and device_code"))
 			return
 		}
 
-		hashedUserAgent, err := bcrypt.GenerateFromPassword([]byte(c.Request.UserAgent()), bcrypt.DefaultCost)
-		if err != nil {
-			logHandler.Error("failed to hash user agent", "error", err.Error())
-
-			logHandler.Debug("debug", "guid", req.GUID)
+		audience, ok := audienceFor(issuer, grant.Resource)
+		if !ok {
+			logHandler.Info("resource is not allowed for client", "resource", grant.Resource)
 
-			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidTarget, ""))
 			return
 		}
 
-		hashedIP, err := bcrypt.GenerateFromPassword([]byte(c.ClientIP()), bcrypt.DefaultCost)
-		if err != nil {
-			logHandler.Error("failed to hash user agent", "error", err.Error())
+		target := issuance{Audience: audience, proofs: proofs, clientID: issuer.ID}
 
-			logHandler.Debug("debug", "guid", req.GUID)
+		// proof необязателен: без него выдается bearer токен
+		proof, err := proofs.Verify(c.Request, "", "")
+		switch {
+		case err == nil:
+			target.JKT = proof.JKT
+			target.proof = proof
+		case !errors.Is(err, dpop.ErrNoProof):
+			logHandler.Info("invalid dpop proof", "error", err.Error())
 
-			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidDPoPProof, err.Error()))
 			return
 		}
 
-		UserInfo := &models.UserInfo{
-			GUID:          req.GUID,
-			UserAgentHash: string(hashedUserAgent),
-			IPhash:        string(hashedIP),
-			TokenHash:     hashedRefToken,
+		switch grant.GrantType {
+		case "":
+			issueUserTokens(c, logHandler, storager, hashPool, issuer, target)
+		case GrantClientCredentials:
+			issueServiceToken(c, logHandler, issuer, target)
+		case GrantAuthorizationCode:
+			exchangeCode(c, logHandler, storager, hashPool, issuer, target)
+		case GrantDeviceCode:
+			pollDevice(c, logHandler, storager, hashPool, issuer, target)
+		case GrantTokenExchange:
+			exchangeToken(c, logHandler, storager, issuer, target)
+		default:
+			logHandler.Info("unsupported grant type", "grantType", grant.GrantType)
+
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrUnsupportedGrantType, ""))
 		}
+	}
+}
 
-		if _, err := saver.SaveUserInfo(ctx, UserInfo); err != nil {
-			if errors.Is(err, storage.ErrGuidExists) {
-				logHandler.Error(err.Error())
-
-				logHandler.Debug("debug", "guid", req.GUID)
-
-				c.JSON(http.StatusBadRequest, response.Error("GUID is already exists"))
-
-				return
-
-			}
-			logHandler.Error("failed to save hash User Info", "error", err.Error())
+// bind разбирает тело как форму (так его шлют OAuth клиенты) или как JSON.
+// JSON тело кешируется, поэтому его можно разбирать несколько раз: сначала grant_type, потом сам grant
+func bind(c *gin.Context, obj any) error {
+	if c.ContentType() == binding.MIMEPOSTForm {
+		return c.ShouldBindWith(obj, binding.Form)
+	}
 
-			logHandler.Debug("debug", "guid", req.GUID)
+	return c.ShouldBindBodyWith(obj, binding.JSON)
+}
 
-			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
-			return
-		}
+// audienceFor выбирает aud токена: запрошенный resource, если клиенту можно получать токены
+// для этого сервиса, иначе аудиторию клиента по умолчанию. Пустая строка - аудитория
+// самого сервера авторизации, ее может запросить любой клиент
+func audienceFor(issuer *models.Client, resource string) (string, bool) {
+	if resource == "" {
+		return issuer.DefaultAudience, true
+	}
 
-		c.SetCookie(
-			"refreshToken", base64.StdEncoding.EncodeToString([]byte(refToken)),
-			int(liveRefresh.Seconds()),
-			"/",
-			"localhost",
-			false,
-			true,
-		)
+	if resource == jwt.Audience() || slices.Contains(scope.Parse(issuer.Audiences), resource) {
+		return resource, true
+	}
 
-		c.JSON(http.StatusOK, Response{Resp: response.OK(), AccessToken: accToken})
+	return "", false
+}
 
+// hashError отвечает 503, если пул хеширования перегружен, и 500 в остальных случаях
+func hashError(c *gin.Context, err error) {
+	if errors.Is(err, hasher.ErrSaturated) {
+		response.Overloaded(c, hasher.RetryAfter)
+		return
 	}
+
+	c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
 }
@@ -0,0 +1,212 @@
+package tokens
+
+import (
+	"log/slog"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/jwt"
+	"medods-test/internal/lib/scope"
+	"medods-test/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	// ScopeImpersonate - scope сотрудника поддержки, с которым его токен может быть actor_token
+	ScopeImpersonate = "impersonate"
+)
+
+type TokenExchangeRequest struct {
+	SubjectToken     string `json:"subject_token" form:"subject_token" validate:"required"`
+	SubjectTokenType string `json:"subject_token_type" form:"subject_token_type" validate:"required"`
+	ActorToken       string `json:"actor_token" form:"actor_token"`
+	ActorTokenType   string `json:"actor_token_type" form:"actor_token_type" validate:"required_with=ActorToken"`
+	// Scope - не шире scope subject_token. Пусто - тот же scope
+	Scope string `json:"scope" form:"scope"`
+	// Audience - сервис, для которого нужен токен, из audiences клиента. Пусто - resource или аудитория клиента по умолчанию
+	Audience string `json:"audience" form:"audience"`
+}
+
+// exchangeToken выдает access токен по чужому токену (RFC 8693). Без actor_token это
+// делегирование: клиент действует от имени пользователя subject_token. С actor_token -
+// сотрудник со scope impersonate действует под пользователем. В обоих случаях токен
+// получает claim act, scope и аудитория могут только сузиться, а обмен пишется в журнал.
+// Токен привязан к сессии пользователя и отзывается вместе с ней
+func exchangeToken(c *gin.Context, logHandler *slog.Logger, storager Storage, issuer *models.Client, target issuance) {
+	ctx := c.Request.Context()
+
+	if !issuer.TokenExchange {
+		logHandler.Info("client is not allowed to exchange tokens")
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrUnauthorizedClient, "client is not allowed to use token-exchange"))
+		return
+	}
+
+	var req TokenExchangeRequest
+
+	if err := bind(c, &req); err != nil {
+		logHandler.Error("failed to decode request body", "error", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidRequest, "failed decode body"))
+		return
+	}
+
+	if err := validator.New().Struct(req); err != nil {
+		logHandler.Info("invalid request", "err", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidRequest, "subject_token and token types are required"))
+		return
+	}
+
+	if req.SubjectTokenType != TokenTypeAccessToken || (req.ActorToken != "" && req.ActorTokenType != TokenTypeAccessToken) {
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidRequest, "only access tokens can be exchanged"))
+		return
+	}
+
+	subject, ok := verifyExchanged(c, logHandler, storager, req.SubjectToken, target.JKT)
+	if !ok {
+		return
+	}
+
+	// прежние участники цепочки сохраняются вложенным act
+	act := &jwt.Actor{Subject: issuer.ID, ClientID: issuer.ID, Act: subject.Act}
+
+	if req.ActorToken != "" {
+		actor, ok := verifyExchanged(c, logHandler, storager, req.ActorToken, target.JKT)
+		if !ok {
+			return
+		}
+
+		if !actor.HasScope(ScopeImpersonate) {
+			logHandler.Warn("actor is not allowed to impersonate", "actor", actor.Subject)
+
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidGrant, "actor_token lacks impersonate scope"))
+			return
+		}
+
+		act = &jwt.Actor{Subject: actor.Subject, ClientID: actor.ClientID, Act: subject.Act}
+	}
+
+	scopes, err := scope.Narrow(scope.Parse(req.Scope), scope.Parse(subject.Scope))
+	if err != nil {
+		logHandler.Info("requested scope is wider than subject token", "error", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidScope, err.Error()))
+		return
+	}
+
+	if req.Audience != "" {
+		target.Audience, ok = audienceFor(issuer, req.Audience)
+		if !ok {
+			logHandler.Info("audience is not allowed for client", "audience", req.Audience)
+
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidTarget, ""))
+			return
+		}
+	}
+
+	// обмененный токен не переживает исходный
+	duration := min(liveExchanged, time.Until(time.Unix(subject.ExpiresAt, 0)))
+
+	grant := jwt.Grant{
+		ID:        uuid.NewString(),
+		Audience:  target.Audience,
+		JKT:       target.JKT,
+		Subject:   subject.Subject,
+		SessionID: subject.SessionID,
+		Scopes:    scopes,
+		Roles:     subject.Roles,
+		ClientID:  issuer.ID,
+		Act:       act,
+	}
+
+	if !target.consumeProof(c, logHandler) {
+		return
+	}
+
+	err = storager.SaveTokenExchange(ctx, &models.TokenExchange{
+		JTI:       grant.ID,
+		ClientID:  issuer.ID,
+		Subject:   subject.Subject,
+		Actor:     act.Subject,
+		SessionID: subject.SessionID,
+		Scope:     scope.Join(scopes),
+		Audience:  target.Audience,
+	})
+	if err != nil {
+		logHandler.Error("failed to save token exchange", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return
+	}
+
+	accToken, err := jwt.NewAccessToken(grant, duration)
+	if err != nil {
+		logHandler.Error("failed to generate jwt", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return
+	}
+
+	logHandler.Info("token exchanged", "subject", subject.Subject, "actor", act.Subject, "jti", grant.ID)
+
+	c.Header("Cache-Control", "no-store")
+
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken:     accToken,
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       target.TokenType(),
+		ExpiresIn:       int64(duration.Seconds()),
+		Scope:           scope.Join(scopes),
+	})
+}
+
+// verifyExchanged проверяет subject_token или actor_token так же, как AuthMiddleware:
+// подпись, срок, сессия пользователя открыта, токен не в черном списке.
+// Токен, привязанный к ключу DPoP, обменивается только с proof этого ключа (jkt из запроса),
+// и выданный токен остается привязанным к нему: иначе обмен снимал бы привязку с украденного токена.
+// Сервисные токены не обмениваются - за ними нет пользователя
+func verifyExchanged(c *gin.Context, logHandler *slog.Logger, storager Storage, token string, jkt string) (*jwt.Claims, bool) {
+	claims, err := jwt.VerifyAnyAudience(token, jwt.TypeAccess)
+	if err != nil {
+		logHandler.Info("failed to verify exchanged token", "error", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidGrant, ""))
+		return nil, false
+	}
+
+	if claims.BoundKey() != "" && claims.BoundKey() != jkt {
+		logHandler.Warn("exchanged token is bound to another dpop key")
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidGrant, "token is bound to a DPoP key, proof of that key is required"))
+		return nil, false
+	}
+
+	if claims.SessionID == "" {
+		logHandler.Info("exchanged token has no user session")
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidGrant, "only user tokens can be exchanged"))
+		return nil, false
+	}
+
+	valid, err := storager.CheckAccess(c.Request.Context(), claims.SessionID, jwt.Fingerprint(token))
+	if err != nil {
+		logHandler.Error("failed to check token revocation", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return nil, false
+	}
+
+	if !valid {
+		logHandler.Info("exchanged token is revoked or session is closed")
+
+		c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidGrant, ""))
+		return nil, false
+	}
+
+	return claims, true
+}
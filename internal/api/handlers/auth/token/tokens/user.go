@@ -0,0 +1,96 @@
+package tokens
+
+import (
+	"log/slog"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/jwt"
+	"medods-test/internal/lib/scope"
+	"medods-test/internal/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// issueUserTokens открывает сессию пользователя req.GUID от имени клиента issuer
+// и выдает пару access и refresh токенов. Это исходный поток /auth/token без grant_type
+func issueUserTokens(c *gin.Context, logHandler *slog.Logger, storager Storage, hashPool Hasher, issuer *models.Client, target issuance) {
+	ctx := c.Request.Context()
+
+	var req Request
+
+	if err := bind(c, &req); err != nil {
+		logHandler.Error("failed to decode request body", "error", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.Error("failed decode body"))
+		return
+	}
+
+	if err := validator.New().Struct(req); err != nil {
+		validatorErr := err.(validator.ValidationErrors)
+
+		logHandler.Error("invalid request", "err", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.ValidationError(validatorErr))
+
+		return
+	}
+
+	// доверенный клиент выпускает токены для любого пользователя, остальные - только для своих
+	if !issuer.Trusted {
+		allowed, err := storager.ClientHasSubject(ctx, issuer.ID, req.GUID)
+		if err != nil {
+			logHandler.Error("failed to check client subject", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		if !allowed {
+			logHandler.Warn("client is not allowed to issue tokens for guid", "guid", req.GUID)
+
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrUnauthorizedClient, "client is not allowed to issue tokens for this user"))
+			return
+		}
+	}
+
+	permissions, err := storager.UserPermissions(ctx, req.GUID)
+	if err != nil {
+		logHandler.Error("failed to get user permissions", "error", err.Error())
+
+		c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+		return
+	}
+
+	scopes, err := scope.Narrow(scope.Parse(req.Scope), permissions.Scopes)
+	if err != nil {
+		logHandler.Info("requested scope is not allowed", "error", err.Error())
+
+		c.JSON(http.StatusBadRequest, response.Error("invalid scope"))
+		return
+	}
+
+	if !target.consumeProof(c, logHandler) {
+		return
+	}
+
+	pair, ok := openSession(c, logHandler, storager, hashPool, jwt.Grant{
+		Audience: target.Audience,
+		JKT:      target.JKT,
+		Subject:  req.GUID,
+		Scopes:   scopes,
+		Roles:    permissions.Roles,
+		ClientID: issuer.ID,
+	}, authentication{})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Resp:        response.OK(),
+		AccessToken: pair.AccessToken,
+		TokenType:   target.TokenType(),
+		IDToken:     pair.IDToken,
+		Scope:       scope.Join(scopes),
+	})
+}
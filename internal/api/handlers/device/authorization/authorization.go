@@ -0,0 +1,126 @@
+package authorization
+
+import (
+	"context"
+	"log/slog"
+	"medods-test/internal/api/middlewares/client"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/jwt"
+	"medods-test/internal/lib/scope"
+	"medods-test/internal/lib/usercode"
+	"medods-test/internal/models"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	liveDeviceCode = time.Minute * 10
+	pollInterval   = time.Second * 5
+)
+
+type Request struct {
+	// Scope - запрошенные scopes через пробел. Разрешенность проверяется, когда пользователь подтверждает запрос
+	Scope string `form:"scope"`
+}
+
+// Response - ответ по RFC 8628 3.2
+type Response struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+type Storage interface {
+	SaveDeviceCode(ctx context.Context, code *models.DeviceCode) error
+}
+
+// @Summary Запрос авторизации устройства (RFC 8628)
+// @Description Устройство без браузера получает device_code и user_code. Пользователь вводит user_code на verification_uri,
+// @Description а устройство опрашивает /auth/token с grant_type=urn:ietf:params:oauth:grant-type:device_code не чаще interval
+// @Tags Auth
+// @Security BasicAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param client_id formData string false "Публичный клиент без HTTP Basic"
+// @Param scope formData string false "Запрошенные scopes через пробел"
+// @Success 200 {object} Response "Коды устройства"
+// @Failure 401 {object} response.OAuthError "Клиент не аутентифицирован"
+// @Failure 500 {object} response.Response "Внутренняя ошибка сервера"
+// @Router /device_authorization [post]
+func New(log *slog.Logger, storager Storage, verificationURI string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		issuer, ok := client.GetClient(c)
+		if !ok {
+			logHandler.Error("failed to get client from context")
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		logHandler = logHandler.With("clientID", issuer.ID)
+
+		var req Request
+
+		if err := c.ShouldBind(&req); err != nil {
+			logHandler.Error("failed to decode request body", "error", err.Error())
+
+			c.JSON(http.StatusBadRequest, response.OAuth(response.ErrInvalidRequest, "failed decode body"))
+			return
+		}
+
+		deviceCode, err := jwt.NewCode()
+		if err != nil {
+			logHandler.Error("failed to generate device code", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		userCode, err := usercode.New()
+		if err != nil {
+			logHandler.Error("failed to generate user code", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		err = storager.SaveDeviceCode(ctx, &models.DeviceCode{
+			DeviceCodeHash: jwt.Fingerprint(deviceCode),
+			UserCode:       userCode,
+			ClientID:       issuer.ID,
+			Scope:          scope.Join(scope.Parse(req.Scope)),
+			Interval:       pollInterval,
+			ExpiresAt:      time.Now().Add(liveDeviceCode),
+		})
+		if err != nil {
+			logHandler.Error("failed to save device code", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+
+		c.JSON(http.StatusOK, Response{
+			DeviceCode:              deviceCode,
+			UserCode:                userCode,
+			VerificationURI:         verificationURI,
+			VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {userCode}}.Encode(),
+			ExpiresIn:               int64(liveDeviceCode.Seconds()),
+			Interval:                int64(pollInterval.Seconds()),
+		})
+	}
+}
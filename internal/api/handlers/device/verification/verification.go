@@ -0,0 +1,202 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"medods-test/internal/api/middlewares/auth"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/scope"
+	"medods-test/internal/lib/usercode"
+	"medods-test/internal/models"
+	"medods-test/internal/storage"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type Request struct {
+	UserCode string `json:"user_code" validate:"required"`
+	// Approve - решение пользователя, false отклоняет запрос устройства
+	Approve *bool `json:"approve" validate:"required"`
+}
+
+type Response struct {
+	Resp     response.Response `json:"response"`
+	ClientID string            `json:"clientId"`
+	Scope    string            `json:"scope"`
+	Status   string            `json:"status"`
+}
+
+type Storage interface {
+	FindDeviceCodeByUserCode(ctx context.Context, userCode string) (*models.DeviceCode, error)
+	ResolveDeviceCode(ctx context.Context, code *models.DeviceCode) error
+	UserPermissions(ctx context.Context, guid string) (*models.Permissions, error)
+	FindSession(ctx context.Context, sessionID string) (*models.Session, error)
+}
+
+// Attempts ограничивает неверные user_code одного пользователя: код короткий, и без
+// ограничения его можно подобрать перебором
+type Attempts interface {
+	Allow(key string) bool
+	Fail(key string)
+}
+
+// @Summary Подтверждение устройства (RFC 8628)
+// @Description Пользователь вводит user_code с экрана устройства и одобряет или отклоняет запрос.
+// @Description Одобренные scopes ограничиваются ролями пользователя и scope его access токена.
+// @Description Подтверждать можно только токеном самой сессии пользователя, неверные user_code ограничены по числу
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Access токен пользователя в формате 'Bearer <token>'"
+// @Param request body Request true "user_code и решение"
+// @Success 200 {object} Response "Решение записано"
+// @Failure 400 {object} response.Response "Невалидные входные данные, запрос истек или scope не разрешен"
+// @Failure 401 {string} string "Неавторизован"
+// @Failure 403 {object} response.Response "Токен получен обменом (act) или выдан не сессии пользователя"
+// @Failure 404 {object} response.Response "Запрос с таким user_code не найден"
+// @Failure 429 {object} response.Response "Слишком много неверных user_code"
+// @Failure 500 {object} response.Response "Внутренняя ошибка сервера"
+// @Router /device [post]
+func New(log *slog.Logger, storager Storage, attempts Attempts) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		claims, ok := auth.GetClaims(c)
+		if !ok {
+			logHandler.Error("failed to get claims from context")
+
+			c.JSON(http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		// одобрение открывает устройству сессию с refresh токеном: короткий обмененный (act)
+		// или сервисный токен не должен превращаться в долгий вход от имени пользователя
+		if !claims.IsSessionOwner() {
+			logHandler.Warn("device approval with a delegated or service token", "sub", claims.Subject)
+
+			c.JSON(http.StatusForbidden, response.Error("Forbidden"))
+			return
+		}
+
+		if !attempts.Allow(claims.Subject) {
+			logHandler.Warn("too many wrong user codes", "sub", claims.Subject)
+
+			c.JSON(http.StatusTooManyRequests, response.Error("too many attempts"))
+			return
+		}
+
+		var req Request
+
+		if err := c.BindJSON(&req); err != nil {
+			logHandler.Error("failed to decode request body", "error", err.Error())
+
+			c.JSON(http.StatusBadRequest, response.Error("failed decode body"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			validatorErr := err.(validator.ValidationErrors)
+
+			logHandler.Error("invalid request", "err", err.Error())
+
+			c.JSON(http.StatusBadRequest, response.ValidationError(validatorErr))
+			return
+		}
+
+		code, err := storager.FindDeviceCodeByUserCode(ctx, usercode.Normalize(req.UserCode))
+		if err != nil {
+			if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+				logHandler.Info("user code is unknown")
+
+				attempts.Fail(claims.Subject)
+
+				c.JSON(http.StatusNotFound, response.Error("device code not found"))
+				return
+			}
+
+			logHandler.Error("failed to find device code", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		logHandler = logHandler.With("clientID", code.ClientID)
+
+		if code.Status != models.DeviceCodePending || time.Now().After(code.ExpiresAt) {
+			logHandler.Info("device code is expired or already resolved", "status", code.Status)
+
+			c.JSON(http.StatusBadRequest, response.Error("device code is expired or already resolved"))
+			return
+		}
+
+		code.Status = models.DeviceCodeDenied
+
+		if *req.Approve {
+			permissions, err := storager.UserPermissions(ctx, claims.Subject)
+			if err != nil {
+				logHandler.Error("failed to get user permissions", "error", err.Error())
+
+				c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+				return
+			}
+
+			// устройство не получает больше, чем токен, которым запрос подтвердили
+			allowed := scope.Intersect(scope.Parse(claims.Scope), permissions.Scopes)
+
+			scopes, err := scope.Narrow(scope.Parse(code.Scope), allowed)
+			if err != nil {
+				logHandler.Info("requested scope is not allowed", "error", err.Error())
+
+				c.JSON(http.StatusBadRequest, response.Error("invalid scope"))
+				return
+			}
+
+			// auth_time ID токена устройства - время входа сессии, из которой его подтвердили
+			session, err := storager.FindSession(ctx, claims.SessionID)
+			if err != nil {
+				logHandler.Error("failed to find user session", "error", err.Error())
+
+				c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+				return
+			}
+
+			code.Status = models.DeviceCodeApproved
+			code.GUID = claims.Subject
+			code.Scope = scope.Join(scopes)
+			code.AuthTime = session.AuthTime
+		}
+
+		if err := storager.ResolveDeviceCode(ctx, code); err != nil {
+			if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+				logHandler.Info("device code was resolved concurrently")
+
+				c.JSON(http.StatusBadRequest, response.Error("device code is expired or already resolved"))
+				return
+			}
+
+			logHandler.Error("failed to resolve device code", "error", err.Error())
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		logHandler.Info("device code resolved", "status", code.Status)
+
+		c.JSON(http.StatusOK, Response{
+			Resp:     response.OK(),
+			ClientID: code.ClientID,
+			Scope:    code.Scope,
+			Status:   code.Status,
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package discovery
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/dpop"
+	jwtLib "medods-test/internal/lib/jwt"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+// Configuration - метаданные провайдера OpenID Connect Discovery 1.0
+type Configuration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint,omitempty"`
+	JwksURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	DPoPSigningAlgValuesSupported     []string `json:"dpop_signing_alg_values_supported"`
+}
+
+// New отдает метаданные провайдера OpenID Connect Discovery: адреса endpoint'ов, поддерживаемые
+// grant'ы и алгоритм подписи. issuer и адреса строятся от PUBLIC_URL, issuer совпадает с iss ID токенов.
+// С JWT_ALG=HS512 OpenID Connect выключен (404): ID токен нечем проверить клиенту.
+// device_authorization_endpoint есть, только если задан DEVICE_VERIFICATION_URI.
+// Маршрут обслуживается от корня (/.well-known/openid-configuration), вне basePath /api/v1, поэтому в swagger его нет
+func New(log *slog.Logger, publicURL string, deviceFlow bool) gin.HandlerFunc {
+	base := strings.TrimSuffix(publicURL, "/")
+
+	grantTypes := []string{"authorization_code", "client_credentials", "urn:ietf:params:oauth:grant-type:token-exchange"}
+
+	var deviceAuthorizationEndpoint string
+	if deviceFlow {
+		deviceAuthorizationEndpoint = base + "/api/v1/device_authorization"
+		grantTypes = append(grantTypes, "urn:ietf:params:oauth:grant-type:device_code")
+	}
+
+	return func(c *gin.Context) {
+
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		logHandler.Debug("openid configuration requested")
+
+		if !jwtLib.OIDCEnabled() {
+			c.JSON(http.StatusNotFound, response.Error("OpenID Connect is disabled"))
+			return
+		}
+
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, Configuration{
+			Issuer:                            jwtLib.OIDCIssuer(),
+			AuthorizationEndpoint:             base + "/api/v1/authorize",
+			TokenEndpoint:                     base + "/api/v1/auth/token",
+			UserinfoEndpoint:                  base + "/api/v1/userinfo",
+			DeviceAuthorizationEndpoint:       deviceAuthorizationEndpoint,
+			JwksURI:                           base + "/.well-known/jwks.json",
+			ResponseTypesSupported:            []string{"code"},
+			GrantTypesSupported:               grantTypes,
+			SubjectTypesSupported:             []string{"public"},
+			IDTokenSigningAlgValuesSupported:  []string{jwtLib.SigningAlg()},
+			ScopesSupported:                   []string{jwtLib.ScopeOpenID, "profile", "sessions"},
+			TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "none"},
+			CodeChallengeMethodsSupported:     []string{"S256"},
+			ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "sid", "azp", "roles"},
+			DPoPSigningAlgValuesSupported:     dpop.SigningAlgs,
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package jwks
+
+import (
+	"log/slog"
+	"net/http"
+
+	jwtLib "medods-test/internal/lib/jwt"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+// New отдает JSON Web Key Set с публичными ключами, которыми подписываются access токены.
+// Для HS512 набор пустой: общий секрет не публикуется.
+// Маршрут обслуживается от корня (/.well-known/jwks.json), вне basePath /api/v1, поэтому в swagger его нет
+func New(log *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		set := jwtLib.PublicJWKS()
+
+		logHandler.Debug("jwks requested", "keys", len(set.Keys))
+
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, set)
+	}
+}
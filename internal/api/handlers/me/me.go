@@ -4,27 +4,31 @@ import (
 	"log/slog"
 	"net/http"
 
+	"medods-test/internal/api/middlewares/auth"
+
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 )
 
+// Response - он же ответ UserInfo OpenID Connect: sub обязателен, guid оставлен
+// для старых клиентов /me, роли отдаются только со scope profile
 type Response struct {
-	GUID string `json:"guid"`
-}
-
-type Claims struct {
-	GUID string `json:"guid"`
+	Sub   string   `json:"sub"`
+	GUID  string   `json:"guid"`
+	Roles []string `json:"roles,omitempty"`
 }
 
-// @Summary Получение GUID пользователя
-// @Description Возвращает GUID пользователя из JWT токена
+// @Summary Получение данных пользователя
+// @Description Возвращает GUID пользователя из JWT токена. /userinfo - тот же ответ в формате UserInfo OpenID Connect,
+// @Description доступен со scope openid; роли возвращаются со scope profile
 // @Tags Auth
 // @Produce json
 // @Security JWT
-// @Success 200 {object} Response "Успешное получение GUID"
+// @Success 200 {object} Response "Успешное получение данных"
 // @Failure 401 {string} string "Неавторизованный запрос"
-// @Router /user/guid [get]
+// @Router /me [get]
+// @Router /userinfo [get]
+// @Router /userinfo [post]
 func New(log *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
@@ -34,23 +38,21 @@ func New(log *slog.Logger) gin.HandlerFunc {
 
 		var Response Response
 
-		claims, ok := c.Get("claims")
+		claims, ok := auth.GetClaims(c)
 		if !ok {
-			logHandler.Error("failed to get guid from context")
+			logHandler.Error("failed to get claims from context")
 
 			c.JSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		jwtClaims, ok := claims.(jwt.MapClaims)
-		if !ok {
-			logHandler.Error("unexepted type of claims")
+		Response.Sub = claims.Subject
+		Response.GUID = claims.Subject
 
-			c.JSON(http.StatusUnauthorized, "Unauthorized")
-			return
+		if claims.HasScope("profile") {
+			Response.Roles = claims.Roles
 		}
 
-		Response.GUID = jwtClaims["guid"].(string)
 		c.JSON(http.StatusOK, Response)
 
 	}
@@ -0,0 +1,89 @@
+package list
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"medods-test/internal/api/middlewares/auth"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/models"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+type Session struct {
+	ID          string    `json:"id"`
+	Device      string    `json:"device"`
+	Location    string    `json:"location"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastRefresh time.Time `json:"last_refresh"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Current     bool      `json:"current"`
+}
+
+type Response struct {
+	Resp     response.Response `json:"response"`
+	Sessions []Session         `json:"sessions"`
+}
+
+type Storage interface {
+	ListSessions(ctx context.Context, guid string) ([]*models.Session, error)
+}
+
+// @Summary Список активных сессий
+// @Description Возвращает активные сессии пользователя: устройство, подсеть клиента, время входа и последнего обновления токенов.
+// @Description Сессия, к которой относится access токен запроса, помечена current=true
+// @Tags Sessions
+// @Produce json
+// @Security JWT
+// @Success 200 {object} Response "Список сессий"
+// @Failure 401 {string} string "Неавторизованный запрос"
+// @Failure 500 {object} response.Response "Внутренняя ошибка сервера"
+// @Router /me/sessions [get]
+func New(log *slog.Logger, storager Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		claims, ok := auth.GetClaims(c)
+		if !ok {
+			logHandler.Error("failed to get claims from context")
+
+			c.JSON(http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		sessions, err := storager.ListSessions(ctx, claims.Subject)
+		if err != nil {
+			logHandler.Error("failed to list sessions", "error", err)
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		resp := Response{
+			Resp:     response.OK(),
+			Sessions: make([]Session, 0, len(sessions)),
+		}
+
+		for _, session := range sessions {
+			resp.Sessions = append(resp.Sessions, Session{
+				ID:          session.ID,
+				Device:      session.Device,
+				Location:    session.Location,
+				CreatedAt:   session.CreatedAt,
+				LastRefresh: session.UpdatedAt,
+				ExpiresAt:   session.ExpiresAt,
+				Current:     session.ID == claims.SessionID,
+			})
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,85 @@
+package terminate
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"medods-test/internal/api/middlewares/auth"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/storage"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type Storage interface {
+	RevokeUserSession(ctx context.Context, guid string, sessionID string) error
+}
+
+// Revocations - кеш проверки отзыва этого экземпляра. В api это revocation.Cache
+type Revocations interface {
+	Forget(sessionID string)
+}
+
+// @Summary Завершение сессии
+// @Description Закрывает одну из сессий пользователя. Ее refresh и access токены перестают приниматься.
+// @Description Можно закрыть и текущую сессию - это равносильно выходу
+// @Tags Sessions
+// @Produce json
+// @Security JWT
+// @Param id path string true "ID сессии"
+// @Success 200 {object} response.Response "Сессия завершена"
+// @Failure 401 {string} string "Неавторизованный запрос"
+// @Failure 404 {object} response.Response "Сессия не найдена или уже завершена"
+// @Failure 500 {object} response.Response "Внутренняя ошибка сервера"
+// @Router /me/sessions/{id} [delete]
+func New(log *slog.Logger, storager Storage, revocations Revocations) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		claims, ok := auth.GetClaims(c)
+		if !ok {
+			logHandler.Error("failed to get claims from context")
+
+			c.JSON(http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		sessionID := c.Param("id")
+
+		if _, err := uuid.Parse(sessionID); err != nil {
+			logHandler.Info("invalid session id", "session", sessionID)
+
+			c.JSON(http.StatusNotFound, response.Error("Session not found"))
+			return
+		}
+
+		err := storager.RevokeUserSession(ctx, claims.Subject, sessionID)
+		if err != nil {
+			if errors.Is(err, storage.ErrSessionNotFound) {
+				logHandler.Info("session not found", "session", sessionID)
+
+				c.JSON(http.StatusNotFound, response.Error("Session not found"))
+				return
+			}
+
+			logHandler.Error("failed to revoke session", "error", err)
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		revocations.Forget(sessionID)
+
+		logHandler.Info("session revoked", "session", sessionID)
+
+		c.JSON(http.StatusOK, response.OK())
+	}
+}
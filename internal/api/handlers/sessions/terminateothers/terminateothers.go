@@ -0,0 +1,61 @@
+package terminateothers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"medods-test/internal/api/middlewares/auth"
+	"medods-test/internal/lib/api/response"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+type Response struct {
+	Resp    response.Response `json:"response"`
+	Revoked int64             `json:"revoked"`
+}
+
+type Storage interface {
+	RevokeOtherSessions(ctx context.Context, guid string, keepSessionID string) (int64, error)
+}
+
+// @Summary Выход на всех других устройствах
+// @Description Закрывает все сессии пользователя, кроме текущей
+// @Tags Sessions
+// @Produce json
+// @Security JWT
+// @Success 200 {object} Response "Число завершенных сессий"
+// @Failure 401 {string} string "Неавторизованный запрос"
+// @Failure 500 {object} response.Response "Внутренняя ошибка сервера"
+// @Router /me/sessions [delete]
+func New(log *slog.Logger, storager Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		claims, ok := auth.GetClaims(c)
+		if !ok {
+			logHandler.Error("failed to get claims from context")
+
+			c.JSON(http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		revoked, err := storager.RevokeOtherSessions(ctx, claims.Subject, claims.SessionID)
+		if err != nil {
+			logHandler.Error("failed to revoke other sessions", "error", err)
+
+			c.JSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		logHandler.Info("other sessions revoked", "count", revoked)
+
+		c.JSON(http.StatusOK, Response{Resp: response.OK(), Revoked: revoked})
+	}
+}
@@ -0,0 +1,100 @@
+package access
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"medods-test/internal/api/middlewares/auth"
+	"medods-test/internal/lib/api/response"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope пропускает запрос, только если в access токене есть все scopes.
+// Ставится после auth.AuthMiddleware. Отказ - 403 с insufficient_scope (RFC 6750)
+func RequireScope(log *slog.Logger, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		claims, ok := auth.GetClaims(c)
+		if !ok {
+			logHandler.Error("failed to get claims from context")
+
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		for _, scope := range scopes {
+			if claims.HasScope(scope) {
+				continue
+			}
+
+			logHandler.Info("insufficient scope", "required", scope, "scope", claims.Scope)
+
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(scopes, " ")))
+			c.AbortWithStatusJSON(http.StatusForbidden, response.Error("insufficient scope"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireRole пропускает запрос, если у пользователя есть хотя бы одна из ролей
+func RequireRole(log *slog.Logger, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		claims, ok := auth.GetClaims(c)
+		if !ok {
+			logHandler.Error("failed to get claims from context")
+
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		for _, role := range roles {
+			if claims.HasRole(role) {
+				c.Next()
+				return
+			}
+		}
+
+		logHandler.Info("missing role", "required", roles, "roles", claims.Roles)
+
+		c.AbortWithStatusJSON(http.StatusForbidden, response.Error("Forbidden"))
+	}
+}
+
+// RequireUser не пускает сервисные токены client_credentials на маршруты пользователя
+func RequireUser(log *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		claims, ok := auth.GetClaims(c)
+		if !ok {
+			logHandler.Error("failed to get claims from context")
+
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		if claims.IsService() {
+			logHandler.Info("service token on user route", "clientID", claims.ClientID)
+
+			c.AbortWithStatusJSON(http.StatusForbidden, response.Error("Forbidden"))
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -4,21 +4,33 @@ import (
 	"context"
 	"log/slog"
 	"medods-test/internal/lib/api/response"
+	"medods-test/internal/lib/dpop"
 	jwtLib "medods-test/internal/lib/jwt"
 	"net/http"
 	"strings"
 
 	"github.com/gin-contrib/requestid"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 )
 
+const ClaimsKey = "claims"
+
+// Provider проверяет отзыв токена. В api это revocation.Cache поверх хранилища
 type Provider interface {
-	IsActive(ctx context.Context, guid string) (bool, error)
-	IsBlocked(ctx context.Context, hashedToken string) (bool, error)
+	CheckAccess(ctx context.Context, sessionID string, fingerprint string) (bool, error)
+}
+
+// Proofs проверяет DPoP proof запроса. В api это dpop.Verifier
+type Proofs interface {
+	Verify(r *http.Request, accessToken string, jkt string) (*dpop.Proof, error)
+	Consume(proof *dpop.Proof, partition string) error
 }
 
-func AuthMiddleware(log *slog.Logger, provider Provider) gin.HandlerFunc {
+// AuthMiddleware пропускает запрос с access токеном, выпущенным для audience - сервиса,
+// который закрывает middleware. Токены других сервисов отклоняются.
+// Токен, привязанный к ключу DPoP (cnf.jkt), принимается только со схемой DPoP
+// и proof этого ключа на этот запрос
+func AuthMiddleware(log *slog.Logger, provider Provider, audience string, proofs Proofs) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		ctx := c.Request.Context()
@@ -37,67 +49,83 @@ func AuthMiddleware(log *slog.Logger, provider Provider) gin.HandlerFunc {
 
 		authTokens := strings.Split(authHeader, " ")
 
-		if len(authTokens) != 2 || authTokens[0] != "Bearer" {
+		if len(authTokens) != 2 || (authTokens[0] != "Bearer" && authTokens[0] != dpop.Scheme) {
 			logHandler.Error("failed to get beraer")
 			c.AbortWithStatus(http.StatusUnauthorized)
+			return
 		}
 
-		token, err := jwtLib.VerifyToken(authTokens[1], "access")
+		claims, err := jwtLib.VerifyToken(authTokens[1], jwtLib.TypeAccess, audience)
 		if err != nil {
-			logHandler.Error("failed to verify token")
+			logHandler.Error("failed to verify token", "error", err)
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 
-		hashedAccessToken, err := jwtLib.HashJWTbcrypt(authTokens[1])
-		if err != nil {
-			logHandler.Error("failet to hash token")
-			c.AbortWithStatus(http.StatusUnauthorized)
-		}
+		// bearer токен со схемой DPoP и привязанный токен со схемой Bearer - ошибка клиента
+		// или попытка предъявить украденный токен без ключа (RFC 9449 7.1)
+		if (claims.BoundKey() != "") != (authTokens[0] == dpop.Scheme) {
+			logHandler.Warn("token binding does not match authorization scheme", "scheme", authTokens[0])
 
-		blocked, err := provider.IsBlocked(ctx, hashedAccessToken)
-		if err != nil {
-			logHandler.Error("failed to check block token")
+			c.Header("WWW-Authenticate", `DPoP error="invalid_token"`)
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 
-		if blocked {
-			logHandler.Info("token is blocked")
-			c.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
+		if claims.BoundKey() != "" {
+			// jti запоминается только после проверки ключа: журнал заполняют лишь владельцы токенов
+			proof, err := proofs.Verify(c.Request, authTokens[1], claims.BoundKey())
+			if err == nil {
+				err = proofs.Consume(proof, proof.JKT)
+			}
 
-		var guidString string
+			if err != nil {
+				logHandler.Warn("failed to verify dpop proof", "error", err.Error())
 
-		claims := token.Claims.(jwt.MapClaims)
-		guid := claims["guid"]
+				c.Header("WWW-Authenticate", `DPoP error="invalid_dpop_proof"`)
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+		}
 
-		switch g := guid.(type) {
-		case string:
-			guidString = string(g)
-		default:
-			logHandler.Error("unexpected type of GUID im claims %T", g)
+		// токены без sid выпущены до появления сессий и больше не принимаются.
+		// Исключение - сервисные токены client_credentials, у них сессии нет
+		if claims.SessionID == "" && !claims.IsService() {
+			logHandler.Info("token has no session")
 
-			c.AbortWithStatus(http.StatusInternalServerError)
+			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 
-		active, err := provider.IsActive(ctx, guidString)
+		valid, err := provider.CheckAccess(ctx, claims.SessionID, jwtLib.Fingerprint(authTokens[1]))
 		if err != nil {
-			logHandler.Error("failed to check active status", "error", err.Error())
+			logHandler.Error("failed to check token revocation", "error", err.Error())
 
-			c.JSON(http.StatusInternalServerError, response.Error("Internal Error"))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, response.Error("Internal Error"))
+			return
 		}
-		if !active {
-			logHandler.Info("Unauthorized")
+		if !valid {
+			logHandler.Info("token is revoked or session is closed")
 
 			c.AbortWithStatus(http.StatusUnauthorized)
+			return
 		}
 
-		c.Set("claims", claims)
+		c.Set(ClaimsKey, claims)
 
 		c.Next()
 	}
 
 }
+
+// GetClaims достает claims, которые AuthMiddleware положил в контекст
+func GetClaims(c *gin.Context) (*jwtLib.Claims, bool) {
+	value, ok := c.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+
+	claims, ok := value.(*jwtLib.Claims)
+
+	return claims, ok
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"medods-test/internal/lib/api/response"
+	"medods-test/internal/models"
+	"medods-test/internal/services/hasher"
+	"medods-test/internal/storage"
+	"net/http"
+
+	"github.com/gin-contrib/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+const ClientKey = "client"
+
+type Provider interface {
+	FindClient(ctx context.Context, clientID string) (*models.Client, error)
+}
+
+type Hasher interface {
+	Compare(ctx context.Context, hash string, value string) (bool, error)
+}
+
+// Authenticate проверяет client_id и секрет клиента из HTTP Basic (client_secret_basic, RFC 6749 2.3.1)
+// и кладет клиента в контекст. Публичный клиент секрета не имеет и передает только client_id в форме.
+// Неизвестный, отключенный клиент и неверный секрет - 401 invalid_client
+func Authenticate(log *slog.Logger, provider Provider, hashPool Hasher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		logHandler := log.With(
+			"requestID", requestid.Get(c),
+		)
+
+		clientID, secret, basic := c.Request.BasicAuth()
+		if !basic {
+			clientID = c.PostForm("client_id")
+		}
+
+		if clientID == "" {
+			logHandler.Info("client credentials are missing")
+
+			unauthorized(c)
+			return
+		}
+
+		logHandler = logHandler.With("clientID", clientID)
+
+		client, err := provider.FindClient(ctx, clientID)
+		if err != nil {
+			if errors.Is(err, storage.ErrClientNotFound) {
+				logHandler.Info("client is not registered")
+
+				unauthorized(c)
+				return
+			}
+
+			logHandler.Error("failed to find client", "error", err.Error())
+
+			c.AbortWithStatusJSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+
+		if !client.IsActive {
+			logHandler.Info("client is disabled")
+
+			unauthorized(c)
+			return
+		}
+
+		// публичный клиент - только без секрета, конфиденциальный - только с секретом в Basic
+		if client.Public == basic {
+			logHandler.Info("client authentication method does not match client type", "public", client.Public)
+
+			unauthorized(c)
+			return
+		}
+
+		if client.Public {
+			c.Set(ClientKey, client)
+
+			c.Next()
+			return
+		}
+
+		valid, err := hashPool.Compare(ctx, client.SecretHash, secret)
+		if err != nil {
+			logHandler.Error("failed to compare client secret", "error", err.Error())
+
+			if errors.Is(err, hasher.ErrSaturated) {
+				c.Abort()
+				response.Overloaded(c, hasher.RetryAfter)
+				return
+			}
+
+			c.AbortWithStatusJSON(http.StatusInternalServerError, response.Error("Internal error"))
+			return
+		}
+		if !valid {
+			logHandler.Info("invalid client secret")
+
+			unauthorized(c)
+			return
+		}
+
+		c.Set(ClientKey, client)
+
+		c.Next()
+	}
+}
+
+// GetClient достает клиента, которого Authenticate положил в контекст
+func GetClient(c *gin.Context) (*models.Client, bool) {
+	value, ok := c.Get(ClientKey)
+	if !ok {
+		return nil, false
+	}
+
+	client, ok := value.(*models.Client)
+
+	return client, ok
+}
+
+// RequireConfidential пропускает только клиента с секретом. Ставится после Authenticate
+// там, где client_id недостаточно: его публичного клиента знает кто угодно
+func RequireConfidential(log *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := GetClient(c)
+		if !ok || client.Public {
+			log.Info("confidential client is required", "requestID", requestid.Get(c))
+
+			unauthorized(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func unauthorized(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="medods-test"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, response.OAuth(response.ErrInvalidClient, "client authentication failed"))
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/joho/godotenv"
@@ -11,7 +12,42 @@ type Config struct {
 	Log          string `env:"LOG_MODE"`
 	ServerHost   string `env:"SRV_HOST"`
 	ServerPort   string `env:"SRV_PORT" env-default:"8080"`
+	DebugAddr    string `env:"DEBUG_ADDR" env-default:"127.0.0.1:6060" env-description:"internal listener for /debug/vars, empty - disabled"`
 	DbConnString string `env:"DB_CONN_STRING, required"`
+
+	JwtAlg        string `env:"JWT_ALG" env-default:"HS512" env-description:"HS512, RS256, ES256 or EdDSA"`
+	JwtSecret     string `env:"JWT_SECRET" env-description:"secret for HS512"`
+	JwtPrivateKey string `env:"JWT_PRIVATE_KEY" env-description:"path to PEM private key for RS256/ES256/EdDSA"`
+
+	TokenHashSecret string `env:"TOKEN_HASH_SECRET" env-description:"HMAC key for token fingerprints, defaults to JWT_SECRET"`
+
+	PublicURL             string `env:"PUBLIC_URL" env-default:"http://localhost:8080" env-description:"external https base URL, also the OpenID Connect issuer"`
+	DeviceVerificationURI string `env:"DEVICE_VERIFICATION_URI" env-description:"frontend page where users enter device user codes, empty - device flow is disabled"`
+
+	DeviceVerificationMaxFailures int           `env:"DEVICE_VERIFICATION_MAX_FAILURES" env-default:"5" env-description:"wrong user codes a user may enter before a lockout"`
+	DeviceVerificationLockout     time.Duration `env:"DEVICE_VERIFICATION_LOCKOUT" env-default:"15m" env-description:"window of counting wrong user codes, also the lockout"`
+
+	JwtIssuer   string `env:"JWT_ISSUER" env-default:"medods-test"`
+	JwtAudience string `env:"JWT_AUDIENCE" env-default:"medods-test" env-description:"aud this service requires, also the default aud of issued tokens"`
+
+	JwtKeysDir        string        `env:"JWT_KEYS_DIR" env-description:"dir to persist rotated signing keys"`
+	JwtKeyRetireAfter time.Duration `env:"JWT_KEY_RETIRE_AFTER" env-default:"168h" env-description:"how long a rotated key is still accepted"`
+	JwtRotateInterval time.Duration `env:"JWT_ROTATE_INTERVAL" env-default:"0" env-description:"scheduled key rotation, 0 - only on SIGHUP; set it on one instance only"`
+
+	JwtKeysReloadInterval time.Duration `env:"JWT_KEYS_RELOAD_INTERVAL" env-default:"1m" env-description:"how often JWT_KEYS_DIR is re-read for keys rotated by another instance, 0 - never"`
+
+	HashWorkers int `env:"HASH_WORKERS" env-default:"0" env-description:"bcrypt workers, 0 - one per CPU"`
+	HashQueue   int `env:"HASH_QUEUE" env-default:"64" env-description:"bcrypt jobs waiting for a worker before requests get 503"`
+
+	RefreshAccessLeeway time.Duration `env:"REFRESH_ACCESS_LEEWAY" env-default:"168h" env-description:"how long after expiry an access token is still accepted by /auth/refresh"`
+	RefreshGrace        time.Duration `env:"REFRESH_GRACE" env-default:"10s" env-description:"how long a rotated refresh token still returns its successor, 0 - never"`
+
+	BootstrapClientID     string `env:"BOOTSTRAP_CLIENT_ID" env-description:"trusted client registered at startup"`
+	BootstrapClientSecret string `env:"BOOTSTRAP_CLIENT_SECRET" env-description:"secret of the bootstrap client"`
+
+	RevocationCacheTTL time.Duration `env:"REVOCATION_CACHE_TTL" env-default:"5s" env-description:"how long a revocation check is reused, 0 - no cache"`
+
+	DPoPProofWindow time.Duration `env:"DPOP_PROOF_WINDOW" env-default:"60s" env-description:"how far DPoP proof iat may be from now, its jti is remembered as long"`
 }
 
 func MustRead() *Config {
@@ -0,0 +1,31 @@
+package response
+
+// OAuthError - ответ об ошибке по RFC 6749 5.2
+type OAuthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+const (
+	ErrInvalidClient        = "invalid_client"
+	ErrUnauthorizedClient   = "unauthorized_client"
+	ErrInvalidRequest       = "invalid_request"
+	ErrInvalidScope         = "invalid_scope"
+	ErrInvalidGrant         = "invalid_grant"
+	ErrUnsupportedGrantType = "unsupported_grant_type"
+	ErrAccessDenied         = "access_denied"
+	ErrInvalidTarget        = "invalid_target"
+	ErrInvalidDPoPProof     = "invalid_dpop_proof"
+
+	// ошибки опроса в device flow, RFC 8628 3.5
+	ErrAuthorizationPending = "authorization_pending"
+	ErrSlowDown             = "slow_down"
+	ErrExpiredToken         = "expired_token"
+)
+
+func OAuth(code string, description string) OAuthError {
+	return OAuthError{
+		Error:       code,
+		Description: description,
+	}
+}
@@ -0,0 +1,15 @@
+package response
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Overloaded отвечает 503 с Retry-After, когда сервис временно не принимает работу
+func Overloaded(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	c.JSON(http.StatusServiceUnavailable, Error("Service unavailable"))
+}
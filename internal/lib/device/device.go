@@ -0,0 +1,80 @@
+package device
+
+import (
+	"net"
+	"strings"
+)
+
+const unknown = "unknown"
+
+// браузеры проверяются по порядку: Edge и Opera тоже содержат "Chrome",
+// а версия Safari записана в "Version/"
+var browsers = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"YaBrowser/", "Yandex Browser"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"Version/", "Safari"},
+	{"curl/", "curl"},
+	{"PostmanRuntime/", "Postman"},
+}
+
+var systems = []struct{ token, name string }{
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// Describe превращает User-Agent в короткое описание устройства вида "Chrome 124 on Windows".
+// Полный User-Agent не хранится - в базе лежит только его bcrypt хеш
+func Describe(userAgent string) string {
+	browser := unknown
+
+	for _, b := range browsers {
+		i := strings.Index(userAgent, b.token)
+		if i < 0 {
+			continue
+		}
+
+		browser = b.name
+
+		version := userAgent[i+len(b.token):]
+		if end := strings.IndexAny(version, ". ;)"); end >= 0 {
+			version = version[:end]
+		}
+		if version != "" {
+			browser += " " + version
+		}
+
+		break
+	}
+
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			return browser + " on " + s.name
+		}
+	}
+
+	return browser
+}
+
+// Location возвращает приблизительное местоположение клиента - его подсеть
+// (/24 для IPv4, /48 для IPv6). Точный IP в открытом виде не хранится
+func Location(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return unknown
+	}
+
+	if v4 := addr.To4(); v4 != nil {
+		network := net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+		return network.String()
+	}
+
+	network := net.IPNet{IP: addr.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}
+	return network.String()
+}
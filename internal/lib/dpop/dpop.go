@@ -0,0 +1,217 @@
+package dpop
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	libJwt "medods-test/internal/lib/jwt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// Header - заголовок запроса с proof
+	Header = "DPoP"
+	// Scheme - схема Authorization и token_type токенов, привязанных к ключу
+	Scheme = "DPoP"
+
+	proofType = "dpop+jwt"
+)
+
+var (
+	ErrNoProof      = errors.New("no dpop proof")
+	ErrInvalidProof = errors.New("invalid dpop proof")
+	ErrReplayed     = errors.New("dpop proof is replayed")
+)
+
+// SigningAlgs - алгоритмы подписи proof. Только асимметричные: ключ клиента публикуется в proof
+var SigningAlgs = []string{libJwt.AlgES256, libJwt.AlgRS256, libJwt.AlgEdDSA}
+
+// ReplayCache помнит jti предъявленных proof по разделам. В api это replay.Cache
+type ReplayCache interface {
+	Remember(partition string, key string, until time.Time) bool
+}
+
+// Proof - проверенный DPoP proof. JKT - thumbprint ключа, которым он подписан
+type Proof struct {
+	JKT      string
+	JTI      string
+	IssuedAt time.Time
+}
+
+type claims struct {
+	jwt.StandardClaims
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	ATH string `json:"ath,omitempty"`
+}
+
+// Valid - iat проверяется в Verify с учетом окна, остальные зарегистрированные claims proof не нужны
+func (c *claims) Valid() error {
+	return nil
+}
+
+// Verifier проверяет proof по RFC 9449 4.3. htu сверяется с адресом запроса на baseURL
+// (PUBLIC_URL): за прокси сервис не знает, по какому адресу к нему обратился клиент.
+// Proof принимается, если iat не дальше window от текущего времени, и только один раз:
+// Verify проверяет его без состояния, Consume отмечает использованным. Между ними
+// вызывающий проверяет клиента, grant или токен, чтобы журнал jti заполняли только
+// запросы, которые и так прошли бы, а не любой, кто сгенерирует ключ
+type Verifier struct {
+	baseURL string
+	window  time.Duration
+	replay  ReplayCache
+}
+
+func NewVerifier(baseURL string, window time.Duration, replay ReplayCache) *Verifier {
+	return &Verifier{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		window:  window,
+		replay:  replay,
+	}
+}
+
+// Verify проверяет proof из заголовка DPoP запроса r. accessToken - токен, который
+// предъявляется вместе с proof защищенному ресурсу, его хеш должен быть в ath.
+// На эндпоинтах выдачи токенов accessToken пустой. Непустой jkt - ключ, к которому
+// привязан токен: proof другого ключа не принимается. Без заголовка - ErrNoProof
+func (v *Verifier) Verify(r *http.Request, accessToken string, jkt string) (*Proof, error) {
+	values := r.Header.Values(Header)
+
+	switch len(values) {
+	case 0:
+		return nil, ErrNoProof
+	case 1:
+	default:
+		return nil, fmt.Errorf("%w: several proofs", ErrInvalidProof)
+	}
+
+	var proofJKT string
+
+	parser := jwt.Parser{ValidMethods: SigningAlgs}
+
+	proofClaims := &claims{}
+
+	_, err := parser.ParseWithClaims(values[0], proofClaims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != proofType {
+			return nil, fmt.Errorf("%w: typ", ErrInvalidProof)
+		}
+
+		key, err := headerJWK(token.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+
+		public, err := key.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+
+		proofJKT, err = key.Thumbprint()
+		if err != nil {
+			return nil, err
+		}
+
+		return public, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProof, err)
+	}
+
+	issuedAt := time.Unix(proofClaims.IssuedAt, 0)
+	now := time.Now()
+
+	switch {
+	case proofClaims.Id == "":
+		return nil, fmt.Errorf("%w: jti", ErrInvalidProof)
+	case proofClaims.HTM != r.Method:
+		return nil, fmt.Errorf("%w: htm", ErrInvalidProof)
+	case !v.matchURI(proofClaims.HTU, r.URL.Path):
+		return nil, fmt.Errorf("%w: htu", ErrInvalidProof)
+	case proofClaims.IssuedAt == 0 || issuedAt.Before(now.Add(-v.window)) || issuedAt.After(now.Add(v.window)):
+		return nil, fmt.Errorf("%w: iat", ErrInvalidProof)
+	}
+
+	if accessToken != "" && subtle.ConstantTimeCompare([]byte(proofClaims.ATH), []byte(AccessTokenHash(accessToken))) != 1 {
+		return nil, fmt.Errorf("%w: ath", ErrInvalidProof)
+	}
+
+	if jkt != "" && proofJKT != jkt {
+		return nil, fmt.Errorf("%w: signed by another key", ErrInvalidProof)
+	}
+
+	return &Proof{JKT: proofJKT, JTI: proofClaims.Id, IssuedAt: issuedAt}, nil
+}
+
+// Consume отмечает proof использованным в разделе partition - клиенте на эндпоинте токенов,
+// ключе на защищенных ресурсах. Повторный proof и переполненный раздел - ErrReplayed.
+// jti уникален в рамках ключа; proof старше окна Verify не примет и так
+func (v *Verifier) Consume(proof *Proof, partition string) error {
+	if !v.replay.Remember(partition, proof.JKT+":"+proof.JTI, proof.IssuedAt.Add(v.window)) {
+		return ErrReplayed
+	}
+
+	return nil
+}
+
+// matchURI сравнивает htu с адресом запроса без query и fragment (RFC 9449 4.3 п. 9)
+func (v *Verifier) matchURI(htu string, path string) bool {
+	parsed, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+
+	return parsed.String() == v.baseURL+path
+}
+
+// headerJWK достает публичный ключ из заголовка jwk. Закрытый ключ в proof - ошибка клиента,
+// такой proof не принимается
+func headerJWK(value interface{}) (*libJwt.JWK, error) {
+	members, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: jwk", ErrInvalidProof)
+	}
+
+	if _, private := members["d"]; private {
+		return nil, fmt.Errorf("%w: jwk contains private key", ErrInvalidProof)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return nil, fmt.Errorf("%w: jwk", ErrInvalidProof)
+	}
+
+	var key libJwt.JWK
+
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("%w: jwk", ErrInvalidProof)
+	}
+
+	return &key, nil
+}
+
+// TokenType - token_type токена, привязанного к ключу jkt: DPoP, а без привязки - Bearer (RFC 9449 5)
+func TokenType(jkt string) string {
+	if jkt != "" {
+		return Scheme
+	}
+
+	return "Bearer"
+}
+
+// AccessTokenHash - ath по RFC 9449 4.2: base64url от SHA-256 access токена
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,169 @@
+package dpop
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	libJwt "medods-test/internal/lib/jwt"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	testBaseURL = "https://auth.example.com"
+	testPath    = "/api/v1/auth/logout"
+	testToken   = "access-token"
+)
+
+// memoryReplay - журнал jti без корзин и лимитов, как replay.Cache для одного раздела
+type memoryReplay map[string]struct{}
+
+func (m memoryReplay) Remember(partition string, key string, until time.Time) bool {
+	id := partition + "\x00" + key
+
+	if _, ok := m[id]; ok {
+		return false
+	}
+
+	m[id] = struct{}{}
+
+	return true
+}
+
+func newKey(t *testing.T) (*ecdsa.PrivateKey, *libJwt.JWK, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk, err := libJwt.NewJWK(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jkt, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, jwk, jkt
+}
+
+func signProof(t *testing.T, key *ecdsa.PrivateKey, jwk *libJwt.JWK, proofClaims *claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, proofClaims)
+	token.Header["typ"] = proofType
+	token.Header["jwk"] = jwk
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestVerify(t *testing.T) {
+	key, jwk, jkt := newKey(t)
+	_, _, otherJKT := newKey(t)
+
+	tests := []struct {
+		name   string
+		modify func(*claims)
+		jkt    string
+		// replay - тот же proof предъявляется второй раз
+		replay  bool
+		noProof bool
+		wantErr error
+	}{
+		{name: "valid", jkt: jkt},
+		{name: "valid without binding", jkt: ""},
+		{name: "replayed jti", jkt: jkt, replay: true, wantErr: ErrReplayed},
+		{name: "no proof", noProof: true, wantErr: ErrNoProof},
+		{name: "no jti", modify: func(c *claims) { c.Id = "" }, wantErr: ErrInvalidProof},
+		{name: "wrong htm", modify: func(c *claims) { c.HTM = http.MethodGet }, wantErr: ErrInvalidProof},
+		{name: "wrong htu", modify: func(c *claims) { c.HTU = testBaseURL + "/api/v1/auth/refresh" }, wantErr: ErrInvalidProof},
+		{name: "htu on another host", modify: func(c *claims) { c.HTU = "https://evil.example.com" + testPath }, wantErr: ErrInvalidProof},
+		{name: "htu with query", modify: func(c *claims) { c.HTU = testBaseURL + testPath + "?a=b" }},
+		{name: "stale iat", modify: func(c *claims) { c.IssuedAt = time.Now().Add(-2 * time.Minute).Unix() }, wantErr: ErrInvalidProof},
+		{name: "future iat", modify: func(c *claims) { c.IssuedAt = time.Now().Add(2 * time.Minute).Unix() }, wantErr: ErrInvalidProof},
+		{name: "no iat", modify: func(c *claims) { c.IssuedAt = 0 }, wantErr: ErrInvalidProof},
+		{name: "wrong ath", modify: func(c *claims) { c.ATH = AccessTokenHash("another-token") }, wantErr: ErrInvalidProof},
+		{name: "no ath", modify: func(c *claims) { c.ATH = "" }, wantErr: ErrInvalidProof},
+		{name: "signed by another key", jkt: otherJKT, wantErr: ErrInvalidProof},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewVerifier(testBaseURL+"/", time.Minute, memoryReplay{})
+
+			proofClaims := &claims{
+				StandardClaims: jwt.StandardClaims{
+					Id:       "proof-" + tt.name,
+					IssuedAt: time.Now().Unix(),
+				},
+				HTM: http.MethodPut,
+				HTU: testBaseURL + testPath,
+				ATH: AccessTokenHash(testToken),
+			}
+
+			if tt.modify != nil {
+				tt.modify(proofClaims)
+			}
+
+			r := httptest.NewRequest(http.MethodPut, testPath, nil)
+			if !tt.noProof {
+				r.Header.Set(Header, signProof(t, key, jwk, proofClaims))
+			}
+
+			proof, err := verifier.Verify(r, testToken, tt.jkt)
+			if err == nil {
+				if proof.JKT != jkt {
+					t.Fatalf("proof.JKT = %q, want %q", proof.JKT, jkt)
+				}
+
+				err = verifier.Consume(proof, proof.JKT)
+			}
+
+			if err == nil && tt.replay {
+				proof, err = verifier.Verify(r, testToken, tt.jkt)
+				if err == nil {
+					err = verifier.Consume(proof, proof.JKT)
+				}
+			}
+
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsSeveralProofs(t *testing.T) {
+	key, jwk, _ := newKey(t)
+
+	verifier := NewVerifier(testBaseURL, time.Minute, memoryReplay{})
+
+	proof := signProof(t, key, jwk, &claims{
+		StandardClaims: jwt.StandardClaims{Id: "proof", IssuedAt: time.Now().Unix()},
+		HTM:            http.MethodPut,
+		HTU:            testBaseURL + testPath,
+	})
+
+	r := httptest.NewRequest(http.MethodPut, testPath, nil)
+	r.Header.Add(Header, proof)
+	r.Header.Add(Header, proof)
+
+	if _, err := verifier.Verify(r, "", ""); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidProof)
+	}
+}
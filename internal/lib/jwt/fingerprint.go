@@ -0,0 +1,17 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Fingerprint - детерминированный HMAC-SHA256 отпечаток токена (hex). Под ним refresh
+// токены хранятся в сессиях, а любые токены - в черном списке: в отличие от bcrypt
+// с солью по отпечатку можно искать, а сам токен в базу не попадает
+func Fingerprint(token string) string {
+	mac := hmac.New(sha256.New, hashSecret)
+	mac.Write([]byte(token))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,69 @@
+package jwt
+
+import (
+	"crypto/sha512"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Запуск: go test -run '^$' -bench . -benchmem ./internal/lib/jwt/
+
+func benchmarkToken(b *testing.B) string {
+	b.Helper()
+
+	if err := Setup(Options{Alg: AlgHS512, Secret: "benchmark-secret-benchmark-secret", Issuer: "bench", Audience: "bench"}); err != nil {
+		b.Fatal(err)
+	}
+
+	token, err := NewAccessToken(Grant{Subject: "bench", SessionID: "57e50af3-763a-4b21-90d9-640e65081189"}, time.Hour)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return token
+}
+
+// BenchmarkFingerprintBcrypt - прежний путь AuthMiddleware: SHA-512 от токена и bcrypt
+// с DefaultCost на каждый запрос
+func BenchmarkFingerprintBcrypt(b *testing.B) {
+	token := benchmarkToken(b)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sum := sha512.Sum512([]byte(token))
+
+		if _, err := bcrypt.GenerateFromPassword(sum[:], bcrypt.DefaultCost); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFingerprintHMAC - текущий путь: HMAC-SHA256 отпечаток, по которому ищется черный список
+func BenchmarkFingerprintHMAC(b *testing.B) {
+	token := benchmarkToken(b)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		Fingerprint(token)
+	}
+}
+
+// BenchmarkVerifyAndFingerprint - вся работа AuthMiddleware над токеном без хранилища:
+// проверка подписи и claims плюс отпечаток
+func BenchmarkVerifyAndFingerprint(b *testing.B) {
+	token := benchmarkToken(b)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := VerifyToken(token, TypeAccess, "bench"); err != nil {
+			b.Fatal(err)
+		}
+
+		Fingerprint(token)
+	}
+}
@@ -0,0 +1,115 @@
+package jwt
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+// ScopeOpenID - scope, при котором вместе с access токеном выдается ID токен
+const ScopeOpenID = "openid"
+
+// IDClaims - claims ID токена OpenID Connect. В отличие от access токена aud - клиент,
+// которому выдан токен, а не API; sid - сессия для выхода по инициативе клиента
+type IDClaims struct {
+	jwt.StandardClaims
+	AuthTime        int64  `json:"auth_time"`
+	Nonce           string `json:"nonce,omitempty"`
+	SessionID       string `json:"sid,omitempty"`
+	AuthorizedParty string `json:"azp,omitempty"`
+}
+
+// Identity - то, на что выпускается ID токен. Nonce передается только при обмене кода:
+// ID токен, выданный при обновлении, его не содержит
+type Identity struct {
+	Subject   string
+	ClientID  string
+	SessionID string
+	Nonce     string
+	AuthTime  time.Time
+}
+
+func NewIDToken(identity Identity, duration time.Duration) (string, error) {
+	now := time.Now()
+
+	claims := &IDClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.NewString(),
+			Subject:   identity.Subject,
+			Issuer:    oidcIssuer,
+			Audience:  identity.ClientID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(duration).Unix(),
+		},
+		AuthTime:        identity.AuthTime.Unix(),
+		Nonce:           identity.Nonce,
+		SessionID:       identity.SessionID,
+		AuthorizedParty: identity.ClientID,
+	}
+
+	return sign(claims)
+}
+
+// OIDCIssuer - issuer OpenID Connect: iss ID токенов и значение issuer в discovery
+func OIDCIssuer() string {
+	return oidcIssuer
+}
+
+// OIDCEnabled - сервер выпускает ID токены. С HS512 ID токен был бы подписан секретом
+// сервера, и клиент не смог бы его проверить (JWKS пуст), поэтому OpenID Connect
+// доступен только с асимметричным алгоритмом
+func OIDCEnabled() bool {
+	return oidcIssuer != "" && SigningAlg() != AlgHS512
+}
+
+// parseOIDCIssuer проверяет issuer по OpenID Connect Discovery 1.0 3: https URL без query
+// и fragment. Завершающий "/" отбрасывается, чтобы issuer совпадал с базой адресов discovery
+func parseOIDCIssuer(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrOIDCIssuer, err)
+	}
+
+	loopback := u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1"
+
+	if u.Host == "" || u.RawQuery != "" || u.Fragment != "" || (u.Scheme != "https" && !(u.Scheme == "http" && loopback)) {
+		return "", fmt.Errorf("%w: %q", ErrOIDCIssuer, raw)
+	}
+
+	return strings.TrimSuffix(raw, "/"), nil
+}
+
+// Audience - aud токенов самого сервера авторизации: его маршруты принимают только их
+func Audience() string {
+	return audience
+}
+
+// IDTokenFor выпускает ID токен к access токену по grant, если клиент его просил
+// (scope openid). Иначе, для сессий без клиента и без OpenID Connect возвращает пустую строку
+func IDTokenFor(grant Grant, nonce string, authTime time.Time, duration time.Duration) (string, error) {
+	if !OIDCEnabled() || grant.ClientID == "" || !slices.Contains(grant.Scopes, ScopeOpenID) {
+		return "", nil
+	}
+
+	return NewIDToken(Identity{
+		Subject:   grant.Subject,
+		ClientID:  grant.ClientID,
+		SessionID: grant.SessionID,
+		Nonce:     nonce,
+		AuthTime:  authTime,
+	}, duration)
+}
+
+// SigningAlg - алгоритм, которым подписываются все токены. Нужен discovery OpenID Connect
+func SigningAlg() string {
+	return ring.Alg()
+}
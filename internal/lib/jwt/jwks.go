@@ -0,0 +1,214 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+var ErrInvalidJWK = errors.New("invalid jwk")
+
+// JWK - публичный ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC, OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS возвращает публичные ключи для проверки токенов.
+// Включает текущий ключ и старые ключи, которые еще не выведены из оборота.
+// Симметричные ключи не публикуются, поэтому для HS512 набор пустой.
+func PublicJWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	for _, key := range ring.Active() {
+		if key.Method.Alg() == AlgHS512 {
+			continue
+		}
+
+		jwk, err := NewJWK(key.verifyKey)
+		if err != nil {
+			continue
+		}
+
+		jwk.Kid = key.ID
+		jwk.Use = "sig"
+		jwk.Alg = key.Method.Alg()
+
+		set.Keys = append(set.Keys, *jwk)
+	}
+
+	return set
+}
+
+// NewJWK переводит публичный ключ в JWK без kid/use/alg
+func NewJWK(public interface{}) (*JWK, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			N:   encodeInt(k.N, 0),
+			E:   encodeInt(big.NewInt(int64(k.E)), 0),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+
+		return &JWK{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   encodeInt(k.X, size),
+			Y:   encodeInt(k.Y, size),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedAlg, public)
+}
+
+// PublicKey восстанавливает публичный ключ из JWK - обратное к NewJWK
+func (j *JWK) PublicKey() (interface{}, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > math.MaxInt32 {
+			return nil, fmt.Errorf("%w: rsa exponent", ErrInvalidJWK)
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if j.Crv != elliptic.P256().Params().Name {
+			return nil, fmt.Errorf("%w: crv %s", ErrUnsupportedAlg, j.Crv)
+		}
+
+		x, err := decodeInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("%w: point is not on curve", ErrInvalidJWK)
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: crv %s", ErrUnsupportedAlg, j.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: x", ErrInvalidJWK)
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("%w: kty %s", ErrUnsupportedAlg, j.Kty)
+}
+
+// Thumbprint считает JWK thumbprint по RFC 7638
+func Thumbprint(public interface{}) (string, error) {
+	jwk, err := NewJWK(public)
+	if err != nil {
+		return "", err
+	}
+
+	return jwk.Thumbprint()
+}
+
+func (j *JWK) Thumbprint() (string, error) {
+	var members interface{}
+
+	// RFC 7638: только обязательные поля в лексикографическом порядке
+	switch j.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.Kty, j.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{j.Crv, j.Kty, j.X, j.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Crv, j.Kty, j.X}
+	default:
+		return "", fmt.Errorf("%w: kty %s", ErrUnsupportedAlg, j.Kty)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal jwk:%w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("%w: malformed integer", ErrInvalidJWK)
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+func encodeInt(n *big.Int, size int) string {
+	b := n.Bytes()
+	if len(b) < size {
+		padded := make([]byte, size)
+		copy(padded[size-len(b):], b)
+		b = padded
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
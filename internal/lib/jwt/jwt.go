@@ -1,104 +1,266 @@
 package jwt
 
 import (
-	"crypto/sha512"
+	"errors"
 	"fmt"
-	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
 )
 
+const (
+	TypeAccess = "access"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrMissingClaim = errors.New("missing required claim")
+)
+
+// Claims - claims наших токенов: зарегистрированные claims RFC 7519, тип токена,
+// id сессии, к которой относится токен, jti выданного вместе с ним refresh токена,
+// выданные scopes (через пробел, как в OAuth 2.0), роли пользователя, клиент,
+// которому выпущен токен (client_id по RFC 9068), тот, кто действует от имени sub (act по RFC 8693),
+// и ключ DPoP, которым владелец токена подписывает запросы (cnf по RFC 9449)
 type Claims struct {
-	Guid string
-	Exp  string
-	Type string
+	jwt.StandardClaims
+	Type           string        `json:"type"`
+	SessionID      string        `json:"sid,omitempty"`
+	RefreshTokenID string        `json:"rti,omitempty"`
+	Scope          string        `json:"scope,omitempty"`
+	Roles          []string      `json:"roles,omitempty"`
+	ClientID       string        `json:"client_id,omitempty"`
+	Act            *Actor        `json:"act,omitempty"`
+	Cnf            *Confirmation `json:"cnf,omitempty"`
 }
 
-func NewAccessToken(GUID string, duration time.Duration) (string, error) {
-	secret := []byte(os.Getenv("JWT_SECRET"))
-	token := jwt.New(jwt.SigningMethodHS512)
+// Confirmation - claim cnf: JKT - JWK thumbprint (RFC 7638) ключа DPoP, к которому привязан токен
+type Confirmation struct {
+	JKT string `json:"jkt"`
+}
 
-	claims := token.Claims.(jwt.MapClaims)
-	claims["guid"] = GUID
-	claims["exp"] = time.Now().Add(duration).Unix()
-	claims["type"] = "access"
-	claims["created_at"] = time.Now().Minute()
+// Actor - claim act: кто действует от имени субъекта токена. Вложенный Act -
+// предыдущее звено цепочки делегирования
+type Actor struct {
+	Subject  string `json:"sub"`
+	ClientID string `json:"client_id,omitempty"`
+	Act      *Actor `json:"act,omitempty"`
+}
 
-	tokenString, err := token.SignedString(secret)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate JWT:%w", err)
+// Grant - то, на что выпускается access токен. Пустые ID и Audience -
+// новый jti и аудитория из конфига (сам сервер авторизации). Непустой JKT
+// привязывает токен к ключу DPoP клиента
+type Grant struct {
+	ID             string
+	Audience       string
+	Subject        string
+	SessionID      string
+	RefreshTokenID string
+	Scopes         []string
+	Roles          []string
+	ClientID       string
+	Act            *Actor
+	JKT            string
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope)
+}
+
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// BoundKey - thumbprint ключа DPoP, к которому привязан токен. Пусто - bearer токен
+func (c *Claims) BoundKey() string {
+	if c.Cnf == nil {
+		return ""
 	}
 
-	return tokenString, nil
+	return c.Cnf.JKT
+}
+
+// IsService - токен выпущен клиенту на себя по client_credentials: сессии нет, sub - сам клиент
+func (c *Claims) IsService() bool {
+	return c.SessionID == "" && c.ClientID != "" && c.Subject == c.ClientID
+}
+
+// IsSessionOwner - токен выдан самому пользователю в его сессии: не сервисный и не получен
+// обменом (act). Только таким токеном можно открыть новую сессию - код или одобрение устройства
+func (c *Claims) IsSessionOwner() bool {
+	return c.SessionID != "" && c.Act == nil && !c.IsService()
+}
+
+// Valid проверяет exp/iat/nbf и наличие обязательных claims.
+// Вызывается парсером при каждой проверке подписи
+func (c *Claims) Valid() error {
+	return c.validate(time.Now(), 0)
+}
+
+// validate - Valid, которая принимает токен, истекший не раньше чем expiryLeeway назад
+func (c *Claims) validate(now time.Time, expiryLeeway time.Duration) error {
+	switch {
+	case c.Subject == "":
+		return fmt.Errorf("%w: sub", ErrMissingClaim)
+	case c.Id == "":
+		return fmt.Errorf("%w: jti", ErrMissingClaim)
+	case c.ExpiresAt == 0:
+		return fmt.Errorf("%w: exp", ErrMissingClaim)
+	case c.IssuedAt == 0:
+		return fmt.Errorf("%w: iat", ErrMissingClaim)
+	}
+
+	switch {
+	case !c.VerifyExpiresAt(now.Add(-expiryLeeway).Unix(), true):
+		return fmt.Errorf("%w: token is expired", ErrInvalidToken)
+	case !c.VerifyIssuedAt(now.Unix(), true):
+		return fmt.Errorf("%w: token used before issued", ErrInvalidToken)
+	case !c.VerifyNotBefore(now.Unix(), true):
+		return fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+// NewAccessToken выпускает access токен по grant: сессия, парный refresh токен, scopes, роли и клиент
+func NewAccessToken(grant Grant, duration time.Duration) (string, error) {
+	return newToken(grant, TypeAccess, duration)
+}
+
+func newToken(grant Grant, tokenType string, duration time.Duration) (string, error) {
+	now := time.Now()
+
+	if grant.ID == "" {
+		grant.ID = uuid.NewString()
+	}
+
+	if grant.Audience == "" {
+		grant.Audience = audience
+	}
+
+	claims := &Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        grant.ID,
+			Subject:   grant.Subject,
+			Issuer:    issuer,
+			Audience:  grant.Audience,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(duration).Unix(),
+		},
+		Type:           tokenType,
+		SessionID:      grant.SessionID,
+		RefreshTokenID: grant.RefreshTokenID,
+		Scope:          strings.Join(grant.Scopes, " "),
+		Roles:          grant.Roles,
+		ClientID:       grant.ClientID,
+		Act:            grant.Act,
+	}
+
+	if grant.JKT != "" {
+		claims.Cnf = &Confirmation{JKT: grant.JKT}
+	}
+
+	return sign(claims)
 }
 
-func NewRefreshToken(GUID string, duration time.Duration) (string, error) {
-	secret := []byte(os.Getenv("JWT_SECRET"))
-	token := jwt.New(jwt.SigningMethodHS512)
+// sign подписывает claims текущим ключом кольца и проставляет его kid
+func sign(claims jwt.Claims) (string, error) {
+	key, err := currentKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate JWT:%w", err)
+	}
 
-	claims := token.Claims.(jwt.MapClaims)
-	claims["guid"] = GUID
-	claims["exp"] = time.Now().Add(duration).Unix()
-	claims["type"] = "refresh"
-	claims["created_at"] = time.Now().Minute()
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
 
-	tokenString, err := token.SignedString(secret)
+	tokenString, err := token.SignedString(key.signKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate JWT:%w", err)
 	}
 
 	return tokenString, nil
 }
-func VerifyToken(tokenString string, expectedType string) (*jwt.Token, error) {
-	secret := []byte(os.Getenv("JWT_SECRET"))
-	// Парсим токен с проверкой подписи
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return secret, nil
-	})
 
+// VerifyToken проверяет подпись, срок действия, iss и тип токена и то, что он выпущен
+// для expectedAudience. Токен другого сервиса не принимается, даже если подписан нами
+func VerifyToken(tokenString string, expectedType string, expectedAudience string) (*Claims, error) {
+	claims, err := verify(tokenString, expectedType, 0)
 	if err != nil {
-		return nil, fmt.Errorf("token parsing failed: %w", err)
+		return nil, err
 	}
 
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
+	if !claims.VerifyAudience(expectedAudience, true) {
+		return nil, fmt.Errorf("%w: aud, expected %s", ErrInvalidToken, expectedAudience)
 	}
 
-	// Проверяем тип токена
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, fmt.Errorf("invalid token claims format")
-	}
+	return claims, nil
+}
+
+// VerifyAnyAudience - VerifyToken для эндпоинтов сервера авторизации, которые получают
+// токен как данные, а не как доступ к себе (introspect, revoke, logout, token-exchange):
+// им нужны токены всех сервисов, поэтому aud не проверяется
+func VerifyAnyAudience(tokenString string, expectedType string) (*Claims, error) {
+	return verify(tokenString, expectedType, 0)
+}
+
+// VerifyExpiredToken - VerifyAnyAudience, которая принимает токен, истекший не более чем leeway назад.
+// Нужна обмену refresh токена: access к этому моменту обычно уже истек, но его подпись
+// и claims по-прежнему доказывают, к какой сессии и паре он относится
+func VerifyExpiredToken(tokenString string, expectedType string, leeway time.Duration) (*Claims, error) {
+	return verify(tokenString, expectedType, leeway)
+}
 
-	// Проверяем наличие обязательных полей
-	if claims["type"] != expectedType {
-		return nil, fmt.Errorf("invalid token type, expected %s", expectedType)
+func verify(tokenString string, expectedType string, expiryLeeway time.Duration) (*Claims, error) {
+	// Парсим токен с проверкой подписи. Алгоритм фиксирован конфигом,
+	// чтобы нельзя было подсунуть HS-токен, подписанный публичным ключом.
+	// Claims проверяются отдельно, чтобы учесть expiryLeeway
+	parser := jwt.Parser{ValidMethods: []string{ring.Alg()}, SkipClaimsValidation: true}
+
+	claims := &Claims{}
+
+	token, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := ring.Lookup(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if key.Method.Alg() != token.Method.Alg() {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, token.Method.Alg())
+		}
+
+		return key.verifyKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("token parsing failed: %w", err)
 	}
 
-	if claims["guid"] == nil {
-		return nil, fmt.Errorf("missing guid claim")
+	if !token.Valid {
+		return nil, ErrInvalidToken
 	}
 
-	// Дополнительная проверка срока действия (jwt.Parse уже проверяет exp)
-	// Но можно добавить кастомные проверки:
-	if exp, ok := claims["exp"].(float64); ok {
-		if time.Now().After(time.Unix(int64(exp), 0)) {
-			return nil, fmt.Errorf("token expired")
-		}
+	if err := claims.validate(time.Now(), expiryLeeway); err != nil {
+		return nil, err
 	}
 
-	return token, nil
-}
+	if claims.Type != expectedType {
+		return nil, fmt.Errorf("%w: type, expected %s", ErrInvalidToken, expectedType)
+	}
 
-func HashJWTbcrypt(jwt string) (string, error) {
-	shaHash := sha512.Sum512([]byte(jwt))
-	shaHashStr := string(shaHash[:])
+	if !claims.VerifyIssuer(issuer, true) {
+		return nil, fmt.Errorf("%w: iss", ErrInvalidToken)
+	}
 
-	hashedJwtToken, err := bcrypt.GenerateFromPassword([]byte(shaHashStr), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+	if claims.Audience == "" {
+		return nil, fmt.Errorf("%w: aud", ErrMissingClaim)
 	}
-	return string(hashedJwtToken), nil
+
+	return claims, nil
 }
@@ -0,0 +1,225 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const testSessionID = "57e50af3-763a-4b21-90d9-640e65081189"
+
+// testClaims - claims access токена, выпущенного в issuedAt и действующего до expiresAt
+func testClaims(issuedAt time.Time, expiresAt time.Time) *Claims {
+	return &Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        "3b1f6c0e-8a8c-4b8e-9d5e-0b2f0f8a7c11",
+			Subject:   "user",
+			Issuer:    "test",
+			Audience:  "test",
+			IssuedAt:  issuedAt.Unix(),
+			NotBefore: issuedAt.Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+		Type:      TypeAccess,
+		SessionID: testSessionID,
+	}
+}
+
+func TestClaimsValidate(t *testing.T) {
+	now := time.Unix(1_750_000_000, 0)
+	leeway := time.Minute
+
+	tests := []struct {
+		name    string
+		claims  func() *Claims
+		leeway  time.Duration
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			claims: func() *Claims { return testClaims(now.Add(-time.Minute), now.Add(time.Minute)) },
+		},
+		{
+			name:   "exp is now",
+			claims: func() *Claims { return testClaims(now.Add(-time.Minute), now) },
+		},
+		{
+			name:    "expired without leeway",
+			claims:  func() *Claims { return testClaims(now.Add(-time.Hour), now.Add(-time.Second)) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:   "exp inside leeway",
+			claims: func() *Claims { return testClaims(now.Add(-time.Hour), now.Add(-30*time.Second)) },
+			leeway: leeway,
+		},
+		{
+			name:   "exp at leeway boundary",
+			claims: func() *Claims { return testClaims(now.Add(-time.Hour), now.Add(-leeway)) },
+			leeway: leeway,
+		},
+		{
+			name:    "exp outside leeway",
+			claims:  func() *Claims { return testClaims(now.Add(-time.Hour), now.Add(-leeway-time.Second)) },
+			leeway:  leeway,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			// leeway относится только к exp
+			name: "nbf in the future",
+			claims: func() *Claims {
+				c := testClaims(now, now.Add(time.Hour))
+				c.NotBefore = now.Add(time.Second).Unix()
+				return c
+			},
+			leeway:  leeway,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "iat in the future",
+			claims: func() *Claims {
+				c := testClaims(now, now.Add(time.Hour))
+				c.IssuedAt = now.Add(time.Second).Unix()
+				return c
+			},
+			leeway:  leeway,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			// nbf проверяется как обязательный: все наши токены его несут
+			name: "no nbf",
+			claims: func() *Claims {
+				c := testClaims(now.Add(-time.Minute), now.Add(time.Hour))
+				c.NotBefore = 0
+				return c
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "no sub",
+			claims: func() *Claims {
+				c := testClaims(now.Add(-time.Minute), now.Add(time.Hour))
+				c.Subject = ""
+				return c
+			},
+			wantErr: ErrMissingClaim,
+		},
+		{
+			name: "no jti",
+			claims: func() *Claims {
+				c := testClaims(now.Add(-time.Minute), now.Add(time.Hour))
+				c.Id = ""
+				return c
+			},
+			wantErr: ErrMissingClaim,
+		},
+		{
+			name: "no exp",
+			claims: func() *Claims {
+				c := testClaims(now.Add(-time.Minute), now.Add(time.Hour))
+				c.ExpiresAt = 0
+				return c
+			},
+			leeway:  leeway,
+			wantErr: ErrMissingClaim,
+		},
+		{
+			name: "no iat",
+			claims: func() *Claims {
+				c := testClaims(now.Add(-time.Minute), now.Add(time.Hour))
+				c.IssuedAt = 0
+				return c
+			},
+			wantErr: ErrMissingClaim,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.claims().validate(now, tt.leeway)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyExpiredToken(t *testing.T) {
+	err := Setup(Options{Alg: AlgHS512, Secret: "test-secret-test-secret-test-secret", Issuer: "test", Audience: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leeway := time.Minute
+
+	tests := []struct {
+		name   string
+		claims func(now time.Time) *Claims
+		leeway time.Duration
+		valid  bool
+	}{
+		{
+			name:   "not expired",
+			claims: func(now time.Time) *Claims { return testClaims(now.Add(-time.Minute), now.Add(time.Minute)) },
+			leeway: leeway,
+			valid:  true,
+		},
+		{
+			name:   "exp inside leeway",
+			claims: func(now time.Time) *Claims { return testClaims(now.Add(-time.Hour), now.Add(-30*time.Second)) },
+			leeway: leeway,
+			valid:  true,
+		},
+		{
+			name:   "exp outside leeway",
+			claims: func(now time.Time) *Claims { return testClaims(now.Add(-time.Hour), now.Add(-2*leeway)) },
+			leeway: leeway,
+			valid:  false,
+		},
+		{
+			name:   "expired without leeway",
+			claims: func(now time.Time) *Claims { return testClaims(now.Add(-time.Hour), now.Add(-30*time.Second)) },
+			valid:  false,
+		},
+		{
+			name: "nbf in the future",
+			claims: func(now time.Time) *Claims {
+				c := testClaims(now, now.Add(time.Hour))
+				c.NotBefore = now.Add(time.Hour).Unix()
+				return c
+			},
+			leeway: leeway,
+			valid:  false,
+		},
+		{
+			name: "iat in the future",
+			claims: func(now time.Time) *Claims {
+				c := testClaims(now, now.Add(time.Hour))
+				c.IssuedAt = now.Add(time.Hour).Unix()
+				return c
+			},
+			leeway: leeway,
+			valid:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := sign(tt.claims(time.Now()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := VerifyExpiredToken(token, TypeAccess, tt.leeway)
+			if (err == nil) != tt.valid {
+				t.Fatalf("VerifyExpiredToken() error = %v, want valid %v", err, tt.valid)
+			}
+
+			if tt.valid && claims.SessionID != testSessionID {
+				t.Fatalf("sid = %q, want %q", claims.SessionID, testSessionID)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// minReloadGap - не чаще скольких раз в секунду токен с неизвестным kid перечитывает
+// каталог ключей: иначе поток токенов со случайным kid читал бы диск на каждый запрос
+const minReloadGap = time.Second
+
+// KeyRing - набор ключей подписи. Подписывает всегда текущий ключ,
+// остальные принимаются для проверки, пока не истек их RetiresAt.
+// Каталог ключей общий для всех экземпляров: ротирует один, остальные
+// подхватывают новый ключ через Reload
+type KeyRing struct {
+	mu sync.RWMutex
+
+	alg         string
+	dir         string
+	retireAfter time.Duration
+
+	keys    map[string]*Key
+	current string
+	// legacy проверяет токены, выпущенные до появления kid
+	legacy *Key
+	// reloadedAt - когда каталог ключей перечитывался последний раз
+	reloadedAt time.Time
+}
+
+func (r *KeyRing) Current() (*Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[r.current]
+	if !ok {
+		return nil, ErrNotConfigured
+	}
+
+	return key, nil
+}
+
+func (r *KeyRing) Alg() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.alg
+}
+
+// Lookup ищет ключ для проверки подписи по kid из заголовка токена. Незнакомый kid
+// мог выпустить другой экземпляр после ротации - тогда каталог ключей перечитывается
+func (r *KeyRing) Lookup(kid string) (*Key, error) {
+	key, err := r.lookup(kid)
+	if !errors.Is(err, ErrUnknownKey) || kid == "" || !r.reloadDue() {
+		return key, err
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r.lookup(kid)
+}
+
+func (r *KeyRing) lookup(kid string) (*Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var key *Key
+
+	if kid == "" {
+		key = r.legacy
+	} else {
+		key = r.keys[kid]
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+
+	if key.retired(time.Now()) {
+		return nil, fmt.Errorf("%w: %q", ErrKeyRetired, kid)
+	}
+
+	return key, nil
+}
+
+func (r *KeyRing) Rotate() (string, error) {
+	key, err := generateKey(r.alg)
+	if err != nil {
+		return "", err
+	}
+
+	if err := r.save(key); err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys[key.ID] = key
+	r.current = key.ID
+	r.retireOthers()
+
+	return key.ID, nil
+}
+
+// Reload дочитывает из каталога ключи, выпущенные другими экземплярами. Самый свежий
+// становится текущим, предыдущим выставляется срок RetireAfter, как после Rotate
+func (r *KeyRing) Reload() error {
+	if r.dir == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reloadedAt = time.Now()
+
+	if err := r.loadDir(); err != nil {
+		return err
+	}
+
+	r.retireOthers()
+
+	return nil
+}
+
+// reloadDue резервирует перечитывание каталога, если с прошлого прошло не меньше minReloadGap
+func (r *KeyRing) reloadDue() bool {
+	if r.dir == "" {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.reloadedAt) < minReloadGap {
+		return false
+	}
+
+	r.reloadedAt = time.Now()
+
+	return true
+}
+
+func (r *KeyRing) Prune() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var pruned []string
+
+	for id, key := range r.keys {
+		if id == r.current || !key.retired(now) {
+			continue
+		}
+
+		delete(r.keys, id)
+		if r.legacy == key {
+			r.legacy = nil
+		}
+		pruned = append(pruned, id)
+
+		if r.dir == "" {
+			continue
+		}
+
+		err := os.Remove(filepath.Join(r.dir, id+keyFileExt))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return pruned, fmt.Errorf("failed to remove key %s:%w", id, err)
+		}
+	}
+
+	return pruned, nil
+}
+
+// Active возвращает ключи, которые еще принимаются для проверки, от новых к старым
+func (r *KeyRing) Active() []*Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var active []*Key
+
+	for _, key := range sortedKeys(r.keys) {
+		if !key.retired(now) {
+			active = append(active, key)
+		}
+	}
+
+	return active
+}
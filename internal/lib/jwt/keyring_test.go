@@ -0,0 +1,292 @@
+package jwt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestRing(t *testing.T, dir string, retireAfter time.Duration) *KeyRing {
+	t.Helper()
+
+	r, err := NewKeyRing(Options{Alg: AlgES256, KeysDir: dir, RetireAfter: retireAfter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func currentID(t *testing.T, r *KeyRing) string {
+	t.Helper()
+
+	key, err := r.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key.ID
+}
+
+func TestRotate(t *testing.T) {
+	tests := []struct {
+		name        string
+		retireAfter time.Duration
+		// oldErr - ошибка Lookup старого kid сразу после ротации
+		oldErr error
+	}{
+		{name: "old kid accepted within RetireAfter", retireAfter: time.Hour},
+		{name: "RetireAfter=0 rejects old kid", retireAfter: 0, oldErr: ErrKeyRetired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			r := newTestRing(t, dir, tt.retireAfter)
+
+			oldID := currentID(t, r)
+
+			newID, err := r.Rotate()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if newID == oldID {
+				t.Fatal("Rotate returned the previous kid")
+			}
+
+			if got := currentID(t, r); got != newID {
+				t.Fatalf("current kid = %q, want %q", got, newID)
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, newID+keyFileExt)); err != nil {
+				t.Fatalf("rotated key is not saved: %v", err)
+			}
+
+			if _, err := r.Lookup(newID); err != nil {
+				t.Fatalf("Lookup(new) = %v", err)
+			}
+
+			_, err = r.Lookup(oldID)
+			if !errors.Is(err, tt.oldErr) || (tt.oldErr == nil && err != nil) {
+				t.Fatalf("Lookup(old) = %v, want %v", err, tt.oldErr)
+			}
+		})
+	}
+}
+
+func TestLookupUnknownKid(t *testing.T) {
+	r := newTestRing(t, t.TempDir(), time.Hour)
+
+	if _, err := r.Lookup("unknown"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Lookup(unknown) = %v, want %v", err, ErrUnknownKey)
+	}
+
+	// токен без kid без ключа из конфига не проверяется
+	if _, err := r.Lookup(""); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Lookup(\"\") = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestRestartReloadsKeysDir(t *testing.T) {
+	dir := t.TempDir()
+
+	before := newTestRing(t, dir, time.Hour)
+	oldID := currentID(t, before)
+
+	newID, err := before.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// рестарт: новая связка с тем же каталогом
+	after := newTestRing(t, dir, time.Hour)
+
+	if got := currentID(t, after); got != newID {
+		t.Fatalf("current kid after restart = %q, want %q", got, newID)
+	}
+
+	if _, err := after.Lookup(oldID); err != nil {
+		t.Fatalf("Lookup(old) after restart = %v", err)
+	}
+
+	if got := len(after.Active()); got != 2 {
+		t.Fatalf("active keys after restart = %d, want 2", got)
+	}
+}
+
+func TestReloadPicksUpRotationOfAnotherInstance(t *testing.T) {
+	dir := t.TempDir()
+
+	first := newTestRing(t, dir, time.Hour)
+	second := newTestRing(t, dir, time.Hour)
+
+	newID, err := first.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// незнакомый kid перечитывает каталог
+	if _, err := second.Lookup(newID); err != nil {
+		t.Fatalf("Lookup(rotated by another instance) = %v", err)
+	}
+
+	if got := currentID(t, second); got != newID {
+		t.Fatalf("current kid after reload = %q, want %q", got, newID)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	r := newTestRing(t, dir, 0)
+
+	oldID := currentID(t, r)
+
+	newID, err := r.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := r.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pruned) != 1 || pruned[0] != oldID {
+		t.Fatalf("pruned = %v, want [%s]", pruned, oldID)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, oldID+keyFileExt)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("pruned key file still exists: %v", err)
+	}
+
+	if _, err := r.Lookup(newID); err != nil {
+		t.Fatalf("Lookup(current) after prune = %v", err)
+	}
+}
+
+func TestVerifyAfterRotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		retireAfter time.Duration
+		valid       bool
+	}{
+		{name: "token of previous key within RetireAfter", retireAfter: time.Hour, valid: true},
+		{name: "token of retired key", retireAfter: 0, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Setup(Options{
+				Alg:         AlgES256,
+				KeysDir:     t.TempDir(),
+				RetireAfter: tt.retireAfter,
+				HashSecret:  "test-hash-secret",
+				Issuer:      "test",
+				Audience:    "test",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := NewAccessToken(Grant{Subject: "user", SessionID: "57e50af3-763a-4b21-90d9-640e65081189"}, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Rotate(); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = VerifyToken(token, TypeAccess, "test")
+			if (err == nil) != tt.valid {
+				t.Fatalf("VerifyToken() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+// rfc7638N - модуль RSA ключа из примера RFC 7638 3.1
+const rfc7638N = "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5" +
+	"JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-" +
+	"bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"
+
+func TestThumbprint(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  JWK
+		want string
+	}{
+		{
+			// RFC 7638 3.1
+			name: "RFC 7638 RSA example",
+			jwk: JWK{
+				Kty: "RSA",
+				N:   rfc7638N,
+				E:   "AQAB",
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			// kid, use и alg в thumbprint не входят
+			name: "optional members ignored",
+			jwk: JWK{
+				Kty: "RSA",
+				Kid: "2011-04-29",
+				Use: "sig",
+				Alg: AlgRS256,
+				N:   rfc7638N,
+				E:   "AQAB",
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.jwk.Thumbprint()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("Thumbprint() = %q, want %q", got, tt.want)
+			}
+
+			// thumbprint восстановленного ключа совпадает с thumbprint JWK
+			public, err := tt.jwk.PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fromKey, err := Thumbprint(public)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fromKey != tt.want {
+				t.Fatalf("Thumbprint(public) = %q, want %q", fromKey, tt.want)
+			}
+		})
+	}
+}
+
+func TestKidIsThumbprint(t *testing.T) {
+	r := newTestRing(t, t.TempDir(), time.Hour)
+
+	key, err := r.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := Thumbprint(key.verifyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key.ID != want {
+		t.Fatalf("kid = %q, want thumbprint %q", key.ID, want)
+	}
+}
@@ -0,0 +1,465 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	AlgHS512 = "HS512"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	pemSecretType = "JWT SECRET"
+	keyFileExt    = ".pem"
+)
+
+var (
+	ErrUnsupportedAlg = errors.New("unsupported signing algorithm")
+	ErrNoSecret       = errors.New("JWT_SECRET is required for HS512")
+	ErrNoHashSecret   = errors.New("TOKEN_HASH_SECRET or JWT_SECRET is required")
+	ErrNotConfigured  = errors.New("signing key is not configured")
+	ErrUnknownKey     = errors.New("unknown signing key")
+	ErrKeyRetired     = errors.New("signing key is retired")
+	ErrOIDCIssuer     = errors.New("OpenID Connect issuer must be an https URL without query and fragment")
+)
+
+// Key - ключ подписи. Для HS512 signKey и verifyKey совпадают и наружу не публикуются
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	CreatedAt time.Time
+	// RetiresAt - с этого момента ключ не принимается даже для проверки. Ноль у текущего ключа
+	RetiresAt time.Time
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+func (k *Key) retired(now time.Time) bool {
+	return !k.RetiresAt.IsZero() && !now.Before(k.RetiresAt)
+}
+
+type Options struct {
+	Alg            string
+	Secret         string
+	PrivateKeyPath string
+	// KeysDir - каталог, где хранятся ключи после ротации, общий для всех экземпляров.
+	// Если пустой, новые ключи живут до рестарта и только в этом экземпляре
+	KeysDir string
+	// RetireAfter - сколько старый ключ остается валидным для проверки после ротации
+	RetireAfter time.Duration
+	// Issuer проставляется в iss и проверяется в VerifyToken. Audience - aud токенов,
+	// для которых не запрошен другой сервис, то есть аудитория самого сервера авторизации
+	Issuer   string
+	Audience string
+	// HashSecret - ключ HMAC для отпечатков токенов (Fingerprint). По умолчанию Secret
+	HashSecret string
+	// OIDCIssuer - iss ID токенов и issuer discovery: внешний https адрес сервера (PUBLIC_URL).
+	// http допускается только для localhost
+	OIDCIssuer string
+}
+
+var ring = &KeyRing{keys: map[string]*Key{}}
+
+var (
+	issuer     string
+	oidcIssuer string
+	audience   string
+	hashSecret []byte
+)
+
+// Setup настраивает связку ключей подписи токенов.
+// Ключи из KeysDir загружаются первыми, самый свежий из них становится текущим.
+// Если каталог пуст - используется JWT_SECRET (HS512) или PEM файл PrivateKeyPath,
+// а для асимметричных алгоритмов без файла генерируется новый ключ.
+func Setup(opts Options) error {
+	newRing, err := NewKeyRing(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.HashSecret == "" {
+		opts.HashSecret = opts.Secret
+	}
+
+	if opts.HashSecret == "" {
+		return ErrNoHashSecret
+	}
+
+	oidc, err := parseOIDCIssuer(opts.OIDCIssuer)
+	if err != nil {
+		return err
+	}
+
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+
+	ring.alg = newRing.alg
+	ring.dir = newRing.dir
+	ring.retireAfter = newRing.retireAfter
+	ring.keys = newRing.keys
+	ring.current = newRing.current
+	ring.legacy = newRing.legacy
+
+	issuer = opts.Issuer
+	oidcIssuer = oidc
+	audience = opts.Audience
+	hashSecret = []byte(opts.HashSecret)
+
+	return nil
+}
+
+// Rotate выпускает новый текущий ключ. Предыдущие ключи остаются валидными для проверки
+// до истечения RetireAfter.
+func Rotate() (string, error) {
+	return ring.Rotate()
+}
+
+// Reload подхватывает ключи, которые другой экземпляр сохранил в KeysDir
+func Reload() error {
+	return ring.Reload()
+}
+
+// Prune удаляет ключи, срок проверки которых истек
+func Prune() ([]string, error) {
+	return ring.Prune()
+}
+
+func currentKey() (*Key, error) {
+	return ring.Current()
+}
+
+func NewKeyRing(opts Options) (*KeyRing, error) {
+	r := &KeyRing{
+		alg:         opts.Alg,
+		dir:         opts.KeysDir,
+		retireAfter: opts.RetireAfter,
+		keys:        map[string]*Key{},
+	}
+
+	if _, err := methodByAlg(opts.Alg); err != nil {
+		return nil, err
+	}
+
+	if opts.KeysDir != "" {
+		if err := r.loadDir(); err != nil {
+			return nil, err
+		}
+	}
+
+	// старые токены без kid проверяются ключом из конфига
+	if opts.Alg == AlgHS512 && opts.Secret != "" {
+		key := secretKey([]byte(opts.Secret), time.Time{})
+		r.legacy = key
+		r.add(key)
+	}
+
+	if opts.Alg != AlgHS512 && opts.PrivateKeyPath != "" {
+		data, err := os.ReadFile(opts.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key:%w", err)
+		}
+
+		key, err := parseKey(opts.Alg, data)
+		if err != nil {
+			return nil, err
+		}
+
+		r.legacy = key
+		r.add(key)
+	}
+
+	if r.current == "" {
+		if opts.Alg == AlgHS512 {
+			return nil, ErrNoSecret
+		}
+
+		key, err := generateKey(opts.Alg)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := r.save(key); err != nil {
+			return nil, err
+		}
+
+		r.add(key)
+	}
+
+	r.retireOthers()
+
+	return r, nil
+}
+
+// add делает ключ текущим, если он свежее текущего
+func (r *KeyRing) add(key *Key) {
+	if _, ok := r.keys[key.ID]; ok {
+		return
+	}
+
+	r.keys[key.ID] = key
+
+	cur, ok := r.keys[r.current]
+	if !ok || key.CreatedAt.After(cur.CreatedAt) {
+		r.current = key.ID
+	}
+}
+
+// retireOthers выставляет срок жизни старым ключам: ключ принимается еще RetireAfter
+// после того, как его сменил более новый
+func (r *KeyRing) retireOthers() {
+	keys := sortedKeys(r.keys)
+
+	for i := 1; i < len(keys); i++ {
+		if keys[i].RetiresAt.IsZero() {
+			keys[i].RetiresAt = keys[i-1].CreatedAt.Add(r.retireAfter)
+		}
+	}
+}
+
+func (r *KeyRing) loadDir() error {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read keys dir:%w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != keyFileExt {
+			continue
+		}
+
+		path := filepath.Join(r.dir, entry.Name())
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read key %s:%w", path, err)
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat key %s:%w", path, err)
+		}
+
+		key, err := parseKey(r.alg, data)
+		if err != nil {
+			return fmt.Errorf("key %s:%w", path, err)
+		}
+
+		key.ID = strings.TrimSuffix(entry.Name(), keyFileExt)
+		key.CreatedAt = info.ModTime()
+
+		r.add(key)
+	}
+
+	return nil
+}
+
+func (r *KeyRing) save(key *Key) error {
+	if r.dir == "" {
+		return nil
+	}
+
+	var block *pem.Block
+
+	switch k := key.signKey.(type) {
+	case []byte:
+		block = &pem.Block{Type: pemSecretType, Bytes: k}
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			return fmt.Errorf("failed to marshal key:%w", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	if err := os.MkdirAll(r.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create keys dir:%w", err)
+	}
+
+	// ключ появляется в каталоге целиком: другой экземпляр может читать каталог в этот момент
+	path := filepath.Join(r.dir, key.ID+keyFileExt)
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(block), 0o600); err != nil {
+		return fmt.Errorf("failed to save key:%w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save key:%w", err)
+	}
+
+	return nil
+}
+
+func methodByAlg(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case AlgHS512:
+		return jwt.SigningMethodHS512, nil
+	case AlgRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgES256:
+		return jwt.SigningMethodES256, nil
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, alg)
+}
+
+func secretKey(secret []byte, createdAt time.Time) *Key {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("kid"))
+
+	return &Key{
+		ID:        base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:16],
+		Method:    jwt.SigningMethodHS512,
+		CreatedAt: createdAt,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+func generateKey(alg string) (*Key, error) {
+	var private interface{}
+	var err error
+
+	switch alg {
+	case AlgHS512:
+		secret := make([]byte, 64)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate secret:%w", err)
+		}
+
+		key := secretKey(secret, time.Now())
+
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return nil, fmt.Errorf("failed to generate kid:%w", err)
+		}
+		key.ID = hex.EncodeToString(id)
+
+		return key, nil
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, alg)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key:%w", alg, err)
+	}
+
+	key, err := asymmetricKey(alg, private)
+	if err != nil {
+		return nil, err
+	}
+	key.CreatedAt = time.Now()
+
+	return key, nil
+}
+
+func parseKey(alg string, data []byte) (*Key, error) {
+	if alg == AlgHS512 {
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != pemSecretType {
+			return nil, fmt.Errorf("%w: expected %s PEM block", ErrUnsupportedAlg, pemSecretType)
+		}
+
+		return secretKey(block.Bytes, time.Time{}), nil
+	}
+
+	var private interface{}
+	var err error
+
+	switch alg {
+	case AlgRS256:
+		private, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+	case AlgES256:
+		private, err = jwt.ParseECPrivateKeyFromPEM(data)
+	case AlgEdDSA:
+		private, err = jwt.ParseEdPrivateKeyFromPEM(data)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, alg)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s key:%w", alg, err)
+	}
+
+	return asymmetricKey(alg, private)
+}
+
+func asymmetricKey(alg string, private interface{}) (*Key, error) {
+	key := &Key{signKey: private}
+
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.verifyKey = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: ES256 requires P-256 key", ErrUnsupportedAlg)
+		}
+		key.Method = jwt.SigningMethodES256
+		key.verifyKey = &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.verifyKey = k.Public()
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedAlg, private)
+	}
+
+	if key.Method.Alg() != alg {
+		return nil, fmt.Errorf("%w: key type doesn't match %s", ErrUnsupportedAlg, alg)
+	}
+
+	kid, err := Thumbprint(key.verifyKey)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = kid
+
+	return key, nil
+}
+
+func sortedKeys(keys map[string]*Key) []*Key {
+	list := make([]*Key, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, key)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+
+	return list
+}
@@ -0,0 +1,55 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+const refreshTokenSize = 32
+
+// NewRefreshToken выпускает непрозрачный refresh токен. В токене нет ни GUID, ни срока
+// действия - все это хранится в базе по Fingerprint
+func NewRefreshToken() (string, error) {
+	token, err := opaque()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate refresh token:%w", err)
+	}
+
+	return token, nil
+}
+
+// NewCode выпускает одноразовый непрозрачный код (код авторизации). Как и refresh
+// токен, в базе он хранится только по Fingerprint
+func NewCode() (string, error) {
+	code, err := opaque()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code:%w", err)
+	}
+
+	return code, nil
+}
+
+func opaque() (string, error) {
+	buf := make([]byte, refreshTokenSize)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// SuccessorRefreshToken выводит из refresh токена его преемника при ротации.
+// Преемник детерминирован, поэтому параллельный запрос с тем же токеном, проигравший
+// гонку за ротацию, может вернуть клиенту уже выданного преемника, а не новую пару.
+// Без ключа hashSecret преемника не вычислить
+func SuccessorRefreshToken(parent string) string {
+	mac := hmac.New(sha256.New, hashSecret)
+	mac.Write([]byte("refresh-successor:"))
+	mac.Write([]byte(parent))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
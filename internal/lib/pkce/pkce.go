@@ -0,0 +1,34 @@
+package pkce
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+const MethodS256 = "S256"
+
+// verifierFormat - code_verifier по RFC 7636 4.1: 43-128 символов из unreserved
+var verifierFormat = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// challengeFormat - base64url без паддинга от SHA-256, всегда 43 символа
+var challengeFormat = regexp.MustCompile(`^[A-Za-z0-9\-_]{43}$`)
+
+// ValidChallenge проверяет, что code_challenge похож на S256 от verifier
+func ValidChallenge(challenge string) bool {
+	return challengeFormat.MatchString(challenge)
+}
+
+// Verify проверяет code_verifier против code_challenge методом S256.
+// Метод plain не поддерживается - он не защищает от перехвата кода
+func Verify(verifier string, challenge string) bool {
+	if !verifierFormat.MatchString(verifier) {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,61 @@
+package pkce
+
+import (
+	"strings"
+	"testing"
+)
+
+// пример из RFC 7636 Appendix B
+const (
+	rfcVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfcChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{name: "RFC 7636 Appendix B", verifier: rfcVerifier, challenge: rfcChallenge, want: true},
+		// plain: code_challenge равен code_verifier, такой challenge не совпадет с S256
+		{name: "plain method", verifier: rfcVerifier, challenge: rfcVerifier, want: false},
+		{name: "wrong verifier", verifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXK", challenge: rfcChallenge, want: false},
+		{name: "empty verifier", verifier: "", challenge: rfcChallenge, want: false},
+		{name: "short verifier", verifier: rfcVerifier[:42], challenge: rfcChallenge, want: false},
+		{name: "long verifier", verifier: strings.Repeat("a", 129), challenge: rfcChallenge, want: false},
+		{name: "verifier with reserved chars", verifier: rfcVerifier[:42] + "+", challenge: rfcChallenge, want: false},
+		{name: "empty challenge", verifier: rfcVerifier, challenge: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.verifier, tt.challenge); got != tt.want {
+				t.Fatalf("Verify(%q, %q) = %v, want %v", tt.verifier, tt.challenge, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidChallenge(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		want      bool
+	}{
+		{name: "S256 challenge", challenge: rfcChallenge, want: true},
+		{name: "padded", challenge: rfcChallenge + "=", want: false},
+		{name: "standard base64", challenge: strings.ReplaceAll(rfcChallenge, "-", "+"), want: false},
+		{name: "plain verifier of other length", challenge: rfcVerifier + "abc", want: false},
+		{name: "empty", challenge: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidChallenge(tt.challenge); got != tt.want {
+				t.Fatalf("ValidChallenge(%q) = %v, want %v", tt.challenge, got, tt.want)
+			}
+		})
+	}
+}
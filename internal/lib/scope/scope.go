@@ -0,0 +1,53 @@
+package scope
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrNotAllowed = errors.New("scope is not allowed")
+
+// Parse разбирает scope в формате OAuth 2.0 - значения через пробел
+func Parse(scope string) []string {
+	scopes := strings.Fields(scope)
+
+	slices.Sort(scopes)
+
+	return slices.Compact(scopes)
+}
+
+func Join(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// Narrow возвращает запрошенные scopes, если все они разрешены. Пустой запрос
+// означает "все разрешенные"
+func Narrow(requested []string, allowed []string) ([]string, error) {
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+
+	for _, s := range requested {
+		if !slices.Contains(allowed, s) {
+			return nil, fmt.Errorf("%w: %s", ErrNotAllowed, s)
+		}
+	}
+
+	return requested, nil
+}
+
+// Intersect оставляет из scopes только разрешенные. Нужна при обновлении токенов:
+// если у пользователя забрали роль, ее scopes пропадают из следующего access токена
+func Intersect(scopes []string, allowed []string) []string {
+	var result []string
+
+	for _, s := range scopes {
+		if slices.Contains(allowed, s) {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
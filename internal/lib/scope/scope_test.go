@@ -0,0 +1,111 @@
+package scope
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope string
+		want  []string
+	}{
+		{name: "empty", scope: "", want: nil},
+		{name: "only spaces", scope: "   ", want: nil},
+		{name: "single", scope: "openid", want: []string{"openid"}},
+		{name: "sorted", scope: "profile openid", want: []string{"openid", "profile"}},
+		{name: "duplicates", scope: "openid profile openid", want: []string{"openid", "profile"}},
+		{name: "extra spaces", scope: "  openid   profile ", want: []string{"openid", "profile"}},
+		{name: "case sensitive", scope: "openid OpenID", want: []string{"OpenID", "openid"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.scope)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Parse(%q) = %q, want %q", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		want   string
+	}{
+		{name: "empty", scopes: nil, want: ""},
+		{name: "single", scopes: []string{"openid"}, want: "openid"},
+		{name: "several", scopes: []string{"openid", "profile"}, want: "openid profile"},
+		{name: "round trip", scopes: Parse("profile openid profile"), want: "openid profile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Join(tt.scopes); got != tt.want {
+				t.Fatalf("Join(%q) = %q, want %q", tt.scopes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNarrow(t *testing.T) {
+	allowed := []string{"openid", "profile", "read"}
+
+	tests := []struct {
+		name      string
+		requested []string
+		allowed   []string
+		want      []string
+		wantErr   error
+	}{
+		{name: "empty request gets all allowed", requested: nil, allowed: allowed, want: allowed},
+		{name: "empty request with nothing allowed", requested: nil, allowed: nil, want: nil},
+		{name: "subset", requested: []string{"openid"}, allowed: allowed, want: []string{"openid"}},
+		{name: "equal set", requested: allowed, allowed: allowed, want: allowed},
+		{name: "parsed duplicates", requested: Parse("read read openid"), allowed: allowed, want: []string{"openid", "read"}},
+		{name: "unknown scope", requested: []string{"openid", "admin"}, allowed: allowed, wantErr: ErrNotAllowed},
+		{name: "nothing allowed", requested: []string{"openid"}, allowed: nil, wantErr: ErrNotAllowed},
+		{name: "case sensitive", requested: []string{"OpenID"}, allowed: allowed, wantErr: ErrNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Narrow(tt.requested, tt.allowed)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Narrow() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Narrow(%q, %q) = %q, want %q", tt.requested, tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		allowed []string
+		want    []string
+	}{
+		{name: "empty scopes", scopes: nil, allowed: []string{"openid"}, want: nil},
+		{name: "nothing allowed", scopes: []string{"openid"}, allowed: nil, want: nil},
+		{name: "all kept", scopes: []string{"openid", "read"}, allowed: []string{"openid", "profile", "read"}, want: []string{"openid", "read"}},
+		{name: "revoked role drops scope", scopes: []string{"openid", "admin"}, allowed: []string{"openid"}, want: []string{"openid"}},
+		{name: "order of scopes kept", scopes: []string{"read", "openid"}, allowed: []string{"openid", "read"}, want: []string{"read", "openid"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Intersect(tt.scopes, tt.allowed)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Intersect(%q, %q) = %q, want %q", tt.scopes, tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
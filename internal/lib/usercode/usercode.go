@@ -0,0 +1,54 @@
+package usercode
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// alphabet - согласные без гласных и похожих символов (RFC 8628 6.1): код не складывается
+// в слова и его трудно перепутать при вводе с клавиатуры телевизора
+const alphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+const length = 8
+
+// New генерирует user_code вида XXXX-XXXX
+func New() (string, error) {
+	var b strings.Builder
+
+	max := big.NewInt(int64(len(alphabet)))
+
+	for i := range length {
+		if i == length/2 {
+			b.WriteByte('-')
+		}
+
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate user code:%w", err)
+		}
+
+		b.WriteByte(alphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+// Normalize приводит введенный пользователем код к виду New: регистр, пробелы
+// и дефисы при вводе не важны
+func Normalize(input string) string {
+	code := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+
+		return r
+	}, strings.ToUpper(input))
+
+	if len(code) != length {
+		return code
+	}
+
+	return code[:length/2] + "-" + code[length/2:]
+}
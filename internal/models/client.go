@@ -0,0 +1,23 @@
+package models
+
+// Client - зарегистрированный OAuth клиент. SecretHash - bcrypt хеш секрета,
+// Trusted - клиент может выпускать токены для любого GUID,
+// Scope - scopes через пробел, которые клиент получает на себя по client_credentials,
+// Public - клиент без секрета, ему доступны только код авторизации с PKCE и device flow,
+// TokenExchange - клиенту разрешен обмен токенов, Audiences - через пробел,
+// для каких сервисов клиент может запрашивать токены, DefaultAudience - aud его токенов,
+// если сервис не запрошен (пусто - сам сервер авторизации), DefaultScope - scopes,
+// которые клиент получает в /authorize без параметра scope (пусто - scope обязателен)
+type Client struct {
+	ID              string
+	Name            string
+	SecretHash      string
+	Trusted         bool
+	Scope           string
+	Public          bool
+	TokenExchange   bool
+	Audiences       string
+	DefaultAudience string
+	DefaultScope    string
+	IsActive        bool
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AuthorizationCode - выданный /authorize код. Сам код не хранится, только CodeHash;
+// CodeChallenge - S256 от code_verifier клиента (PKCE), Nonce и AuthTime уходят в ID токен
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	GUID          string
+	RedirectURI   string
+	Scope         string
+	CodeChallenge string
+	Nonce         string
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+	DeviceCodeUsed     = "used"
+)
+
+// DeviceCode - запрос авторизации устройства (RFC 8628). Сам device_code не хранится,
+// только DeviceCodeHash; GUID и AuthTime заполняются, когда пользователь подтвердил запрос.
+// LastPolledAt - время предыдущего опроса /auth/token, по нему отвечается slow_down
+type DeviceCode struct {
+	DeviceCodeHash string
+	UserCode       string
+	ClientID       string
+	Scope          string
+	Status         string
+	GUID           string
+	AuthTime       time.Time
+	Interval       time.Duration
+	LastPolledAt   *time.Time
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+}
@@ -0,0 +1,7 @@
+package models
+
+// Permissions - роли пользователя и scopes, которые эти роли разрешают выдавать
+type Permissions struct {
+	Roles  []string
+	Scopes []string
+}
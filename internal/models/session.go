@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Session - одна авторизация пользователя (устройство). У одного GUID может быть
+// несколько сессий; TokenHash - HMAC хеш текущего refresh токена сессии.
+// Device и Location - то, что видит пользователь в списке своих сессий,
+// Scope - выданные при входе scopes через пробел, ClientID - клиент, открывший сессию,
+// AuthTime - когда пользователь вошел (auth_time в ID токене)
+type Session struct {
+	ID            string
+	GUID          string
+	TokenHash     string
+	UserAgentHash string
+	IPhash        string
+	Device        string
+	Location      string
+	Scope         string
+	ClientID      string
+	AuthTime      time.Time
+	IsActive      bool
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
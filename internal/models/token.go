@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// RefreshToken - звено семейства refresh токенов сессии. RotatedAt проставляется, когда
+// токен обменяли на потомка; повторное предъявление такого токена - признак кражи.
+// JTI попадает в claim rti access токена, выданного в паре с этим refresh токеном
+type RefreshToken struct {
+	ID               int
+	JTI              string
+	JKT              string
+	SessionID        string
+	ParentID         *int
+	GUID             string
+	TokenHash        string
+	RotatedAt        *time.Time
+	SessionRevokedAt *time.Time
+	CreatedAt        time.Time
+}
+
+// Rotation - все изменения одного обмена refresh токена, которые сохраняются атомарно:
+// Parent заменяется потомком RefreshJTI, отпечатки Blocked уходят в черный список,
+// Session - новое состояние сессии (TokenHash - отпечаток нового refresh токена),
+// JKT - отпечаток DPoP ключа, к которому привязана новая пара
+type Rotation struct {
+	Parent     *RefreshToken
+	Session    *Session
+	RefreshJTI string
+	JKT        string
+	Blocked    []string
+}
+
+// TokenExchange - запись журнала обмена токенов (RFC 8693): клиент ClientID получил
+// токен JTI для Subject, действует Actor
+type TokenExchange struct {
+	JTI       string
+	ClientID  string
+	Subject   string
+	Actor     string
+	SessionID string
+	Scope     string
+	Audience  string
+}
@@ -1,8 +0,0 @@
-package models
-
-type UserInfo struct {
-	GUID          string
-	TokenHash     string
-	UserAgentHash string
-	IPhash        string
-}
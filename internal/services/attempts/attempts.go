@@ -0,0 +1,90 @@
+package attempts
+
+import (
+	"sync"
+	"time"
+)
+
+// maxKeys ограничивает память: при переполнении новые ключи не заводятся и
+// сразу считаются заблокированными, уже отслеживаемые работают как обычно
+const maxKeys = 100_000
+
+type window struct {
+	failures int
+	resetAt  time.Time
+}
+
+// Limiter - in-process счетчик неудачных попыток по ключу (пользователю). После max
+// неудач ключ блокируется до конца окна, отсчитанного от первой неудачи.
+// Как и журнал DPoP, счетчик у каждого экземпляра свой
+type Limiter struct {
+	mu      sync.Mutex
+	max     int
+	period  time.Duration
+	windows map[string]*window
+}
+
+func New(max int, period time.Duration) *Limiter {
+	return &Limiter{
+		max:     max,
+		period:  period,
+		windows: make(map[string]*window),
+	}
+}
+
+// Allow - можно ли ключу сделать еще одну попытку
+func (l *Limiter) Allow(key string) bool {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.windows[key]
+	if !ok {
+		return len(l.windows) < maxKeys
+	}
+
+	if !now.Before(w.resetAt) {
+		delete(l.windows, key)
+		return true
+	}
+
+	return w.failures < l.max
+}
+
+// Fail засчитывает ключу неудачную попытку
+func (l *Limiter) Fail(key string) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.windows[key]
+	if ok && !now.Before(w.resetAt) {
+		ok = false
+	}
+
+	if !ok {
+		if len(l.windows) >= maxKeys {
+			l.sweep(now)
+		}
+
+		if len(l.windows) >= maxKeys {
+			return
+		}
+
+		w = &window{resetAt: now.Add(l.period)}
+		l.windows[key] = w
+	}
+
+	w.failures++
+}
+
+// sweep выбрасывает истекшие окна. Вызывается только при переполнении
+func (l *Limiter) sweep(now time.Time) {
+	for key, w := range l.windows {
+		if !now.Before(w.resetAt) {
+			delete(l.windows, key)
+		}
+	}
+}
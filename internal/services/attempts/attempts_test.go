@@ -0,0 +1,41 @@
+package attempts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		period   time.Duration
+		wait     time.Duration
+		allowed  bool
+	}{
+		{name: "no failures", failures: 0, period: time.Minute, allowed: true},
+		{name: "below limit", failures: 2, period: time.Minute, allowed: true},
+		{name: "limit reached", failures: 3, period: time.Minute, allowed: false},
+		{name: "window expired", failures: 3, period: 10 * time.Millisecond, wait: 20 * time.Millisecond, allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := New(3, tt.period)
+
+			for i := 0; i < tt.failures; i++ {
+				limiter.Fail("user")
+			}
+
+			time.Sleep(tt.wait)
+
+			if got := limiter.Allow("user"); got != tt.allowed {
+				t.Fatalf("Allow() = %v, want %v", got, tt.allowed)
+			}
+
+			if !limiter.Allow("other") {
+				t.Fatal("failures of one key must not block another")
+			}
+		})
+	}
+}
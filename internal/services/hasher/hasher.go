@@ -0,0 +1,145 @@
+package hasher
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"runtime"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RetryAfter - через сколько клиенту стоит повторить запрос, отклоненный из-за ErrSaturated
+const RetryAfter = time.Second
+
+var (
+	ErrSaturated = errors.New("hashing queue is full")
+	ErrClosed    = errors.New("hasher is closed")
+)
+
+// метрики доступны на /debug/vars (DEBUG_ADDR) в разделе "hasher"
+var metrics = expvar.NewMap("hasher")
+
+type job struct {
+	ctx    context.Context
+	run    func() (string, error)
+	queued time.Time
+	result chan result
+}
+
+type result struct {
+	value string
+	err   error
+}
+
+// Hasher - общий для всех обработчиков пул воркеров для bcrypt. Число одновременно
+// считаемых хешей ограничено числом воркеров, а ожидающих - длиной очереди: при
+// переполнении запрос сразу получает ErrSaturated, вместо того чтобы отъедать CPU у остальных
+type Hasher struct {
+	jobs chan job
+	done chan struct{}
+}
+
+// New запускает workers воркеров (0 - по числу CPU) с очередью на queue заданий
+func New(workers int, queue int) *Hasher {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	h := &Hasher{
+		jobs: make(chan job, queue),
+		done: make(chan struct{}),
+	}
+
+	metrics.Set("queue_depth", expvar.Func(func() any { return len(h.jobs) }))
+	metrics.Set("queue_capacity", expvar.Func(func() any { return cap(h.jobs) }))
+	metrics.Set("workers", expvar.Func(func() any { return workers }))
+
+	for range workers {
+		go h.work()
+	}
+
+	return h
+}
+
+// Close останавливает воркеров. Задания, оставшиеся в очереди, не выполняются
+func (h *Hasher) Close() {
+	close(h.done)
+}
+
+// Hash считает bcrypt хеш value
+func (h *Hasher) Hash(ctx context.Context, value string) (string, error) {
+	return h.submit(ctx, func() (string, error) {
+		hash, err := bcrypt.GenerateFromPassword([]byte(value), bcrypt.DefaultCost)
+
+		return string(hash), err
+	})
+}
+
+// Compare сверяет value с bcrypt хешем. Несовпадение - это false без ошибки
+func (h *Hasher) Compare(ctx context.Context, hash string, value string) (bool, error) {
+	_, err := h.submit(ctx, func() (string, error) {
+		return "", bcrypt.CompareHashAndPassword([]byte(hash), []byte(value))
+	})
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (h *Hasher) submit(ctx context.Context, run func() (string, error)) (string, error) {
+	j := job{
+		ctx:    ctx,
+		run:    run,
+		queued: time.Now(),
+		result: make(chan result, 1),
+	}
+
+	select {
+	case <-h.done:
+		return "", ErrClosed
+	case h.jobs <- j:
+	default:
+		metrics.Add("saturated", 1)
+
+		return "", ErrSaturated
+	}
+
+	select {
+	case res := <-j.result:
+		return res.value, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (h *Hasher) work() {
+	for {
+		select {
+		case <-h.done:
+			return
+		case j := <-h.jobs:
+			// клиент уже ушел - не тратим на него CPU
+			if err := j.ctx.Err(); err != nil {
+				metrics.Add("canceled", 1)
+				j.result <- result{err: err}
+
+				continue
+			}
+
+			started := time.Now()
+			value, err := j.run()
+
+			metrics.Add("completed", 1)
+			metrics.Add("wait_ns_total", started.Sub(j.queued).Nanoseconds())
+			metrics.Add("hash_ns_total", time.Since(started).Nanoseconds())
+
+			j.result <- result{value: value, err: err}
+		}
+	}
+}
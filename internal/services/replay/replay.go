@@ -0,0 +1,108 @@
+package replay
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// maxPerPartition - сколько значений одновременно помнится для одного раздела
+	// (клиента или ключа). Переполнение раздела отказывает только ему, а не всем
+	maxPerPartition = 10_000
+	// maxEntries ограничивает память кеша целиком
+	maxEntries = 1_000_000
+)
+
+type entry struct {
+	partition string
+	id        string
+}
+
+// Cache - in-process журнал одноразовых значений (jti DPoP proof). Значение помнится,
+// пока его можно предъявить повторно, то есть до until. Записи лежат в корзинах по секунде
+// until, поэтому устаревшие выбрасываются целыми корзинами за время, пропорциональное
+// их числу, без обхода всего кеша под мьютексом.
+// Журнал у каждого экземпляра сервиса свой, поэтому proof, перехваченный по дороге
+// к одному экземпляру, можно повторить на другом в пределах окна iat - окно поэтому короткое
+type Cache struct {
+	mu      sync.Mutex
+	seen    map[string]struct{}
+	counts  map[string]int
+	buckets map[int64][]entry
+	// evicted - последняя секунда, корзины до которой включительно уже выброшены
+	evicted int64
+}
+
+func New() *Cache {
+	return &Cache{
+		seen:    make(map[string]struct{}),
+		counts:  make(map[string]int),
+		buckets: make(map[int64][]entry),
+		evicted: time.Now().Unix(),
+	}
+}
+
+// Remember запоминает key раздела partition до until. Возвращает false, если key уже
+// встречался в этом разделе или раздел переполнен - в обоих случаях значение нельзя принимать
+func (c *Cache) Remember(partition string, key string, until time.Time) bool {
+	now := time.Now().Unix()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evict(now)
+
+	id := partition + "\x00" + key
+
+	if _, ok := c.seen[id]; ok {
+		return false
+	}
+
+	if c.counts[partition] >= maxPerPartition || len(c.seen) >= maxEntries {
+		return false
+	}
+
+	// значение, которое уже нельзя предъявить, все равно держится до следующей секунды
+	second := max(until.Unix(), now+1)
+
+	c.seen[id] = struct{}{}
+	c.counts[partition]++
+	c.buckets[second] = append(c.buckets[second], entry{partition: partition, id: id})
+
+	return true
+}
+
+// evict выбрасывает корзины по секунду now включительно. После долгого простоя
+// дешевле пройти по самим корзинам, чем по каждой пропущенной секунде
+func (c *Cache) evict(now int64) {
+	if now <= c.evicted {
+		return
+	}
+
+	if now-c.evicted > int64(len(c.buckets)) {
+		for second := range c.buckets {
+			if second <= now {
+				c.drop(second)
+			}
+		}
+	} else {
+		for second := c.evicted + 1; second <= now; second++ {
+			c.drop(second)
+		}
+	}
+
+	c.evicted = now
+}
+
+func (c *Cache) drop(second int64) {
+	for _, e := range c.buckets[second] {
+		delete(c.seen, e.id)
+
+		c.counts[e.partition]--
+		if c.counts[e.partition] <= 0 {
+			delete(c.counts, e.partition)
+		}
+	}
+
+	delete(c.buckets, second)
+}
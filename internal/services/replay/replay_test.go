@@ -0,0 +1,110 @@
+package replay
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRemember(t *testing.T) {
+	type call struct {
+		partition string
+		key       string
+		want      bool
+	}
+
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name:  "first use",
+			calls: []call{{"key-a", "jti-1", true}},
+		},
+		{
+			name:  "replay in same partition",
+			calls: []call{{"key-a", "jti-1", true}, {"key-a", "jti-1", false}},
+		},
+		{
+			name:  "same jti in another partition",
+			calls: []call{{"key-a", "jti-1", true}, {"key-b", "jti-1", true}},
+		},
+		{
+			name:  "different jti in same partition",
+			calls: []call{{"key-a", "jti-1", true}, {"key-a", "jti-2", true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := New()
+			until := time.Now().Add(time.Minute)
+
+			for i, c := range tt.calls {
+				if got := cache.Remember(c.partition, c.key, until); got != c.want {
+					t.Fatalf("call %d: Remember(%q, %q) = %v, want %v", i, c.partition, c.key, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRememberPartitionLimit(t *testing.T) {
+	cache := New()
+	until := time.Now().Add(time.Minute)
+
+	for i := 0; i < maxPerPartition; i++ {
+		if !cache.Remember("full", strconv.Itoa(i), until) {
+			t.Fatalf("Remember(%d) rejected before the partition is full", i)
+		}
+	}
+
+	if cache.Remember("full", "overflow", until) {
+		t.Fatal("full partition must reject new values")
+	}
+
+	if !cache.Remember("other", "overflow", until) {
+		t.Fatal("full partition must not affect another one")
+	}
+}
+
+func TestEvict(t *testing.T) {
+	tests := []struct {
+		name string
+		// after - через сколько секунд от until кеш выбрасывает корзины
+		after     int64
+		forgotten bool
+	}{
+		{name: "before until", after: -1, forgotten: false},
+		{name: "until second", after: 0, forgotten: true},
+		{name: "after until", after: 1, forgotten: true},
+		{name: "after long idle", after: 3600, forgotten: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := New()
+			now := time.Now().Unix()
+			until := time.Unix(now+10, 0)
+
+			if !cache.Remember("key", "jti", until) {
+				t.Fatal("first Remember rejected")
+			}
+
+			// время кеша сдвигается вызовом evict, как при очередном Remember
+			cache.mu.Lock()
+			cache.evict(until.Unix() + tt.after)
+			_, seen := cache.seen["key\x00jti"]
+			partitionCount := cache.counts["key"]
+			cache.mu.Unlock()
+
+			if seen == tt.forgotten {
+				t.Fatalf("value seen = %v after evict, want %v", seen, !tt.forgotten)
+			}
+
+			if tt.forgotten && partitionCount != 0 {
+				t.Fatalf("partition count = %d after evict, want 0", partitionCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxEntries ограничивает память кеша. При переполнении сначала выкидываются
+// устаревшие записи, а если их нет - кеш сбрасывается целиком
+const maxEntries = 100_000
+
+type Checker interface {
+	CheckAccess(ctx context.Context, sessionID string, fingerprint string) (bool, error)
+}
+
+type entry struct {
+	valid     bool
+	checkedAt time.Time
+}
+
+// Cache - in-process кеш проверки отзыва access токенов. Ответ хранилища по паре
+// (сессия, отпечаток токена) переиспользуется не дольше ttl, поэтому отзыв сессии
+// или токена доходит до других экземпляров сервиса максимум за ttl. Экземпляр,
+// который сам отзывает сессию, сразу забывает ее записи через Forget.
+// ttl <= 0 отключает кеш - каждая проверка идет в хранилище
+type Cache struct {
+	checker Checker
+	ttl     time.Duration
+
+	mu sync.RWMutex
+	// sessions - записи по сессии и отпечатку токена, size - их общее число
+	sessions map[string]map[string]entry
+	size     int
+	// generation растет с каждым Forget: ответ хранилища, полученный до отзыва,
+	// не должен попасть в кеш после него
+	generation uint64
+}
+
+func New(checker Checker, ttl time.Duration) *Cache {
+	return &Cache{
+		checker:  checker,
+		ttl:      ttl,
+		sessions: make(map[string]map[string]entry),
+	}
+}
+
+// CheckAccess возвращает true, если сессия активна и токен не в черном списке
+func (c *Cache) CheckAccess(ctx context.Context, sessionID string, fingerprint string) (bool, error) {
+	if c.ttl <= 0 {
+		return c.checker.CheckAccess(ctx, sessionID, fingerprint)
+	}
+
+	now := time.Now()
+
+	c.mu.RLock()
+	cached, ok := c.sessions[sessionID][fingerprint]
+	generation := c.generation
+	c.mu.RUnlock()
+
+	if ok && now.Sub(cached.checkedAt) < c.ttl {
+		return cached.valid, nil
+	}
+
+	valid, err := c.checker.CheckAccess(ctx, sessionID, fingerprint)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// пока шел запрос в хранилище, что-то отозвали - ответ мог устареть
+	if c.generation != generation {
+		return valid, nil
+	}
+
+	if c.size >= maxEntries {
+		c.evict(now)
+	}
+
+	tokens, ok := c.sessions[sessionID]
+	if !ok {
+		tokens = make(map[string]entry)
+		c.sessions[sessionID] = tokens
+	}
+
+	if _, ok := tokens[fingerprint]; !ok {
+		c.size++
+	}
+
+	tokens[fingerprint] = entry{valid: valid, checkedAt: now}
+
+	return valid, nil
+}
+
+// Forget забывает закешированные ответы по сессии sessionID. Вызывается после того,
+// как этот экземпляр закрыл сессию или заблокировал ее токен: следующая проверка
+// пойдет в хранилище, а не вернет "не отозван" из кеша
+func (c *Cache) Forget(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.size -= len(c.sessions[sessionID])
+	delete(c.sessions, sessionID)
+}
+
+func (c *Cache) evict(now time.Time) {
+	for sessionID, tokens := range c.sessions {
+		for fingerprint, cached := range tokens {
+			if now.Sub(cached.checkedAt) >= c.ttl {
+				delete(tokens, fingerprint)
+				c.size--
+			}
+		}
+
+		if len(tokens) == 0 {
+			delete(c.sessions, sessionID)
+		}
+	}
+
+	if c.size >= maxEntries {
+		c.sessions = make(map[string]map[string]entry)
+		c.size = 0
+	}
+}
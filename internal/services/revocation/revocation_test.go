@@ -0,0 +1,155 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type staticChecker struct{}
+
+func (staticChecker) CheckAccess(ctx context.Context, sessionID string, fingerprint string) (bool, error) {
+	return true, nil
+}
+
+// BenchmarkCacheHit - проверка отзыва, когда ответ хранилища уже в кеше:
+// так проходит большинство запросов в пределах REVOCATION_CACHE_TTL
+func BenchmarkCacheHit(b *testing.B) {
+	cache := New(staticChecker{}, time.Minute)
+	ctx := context.Background()
+
+	if _, err := cache.CheckAccess(ctx, "session", "fingerprint"); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := cache.CheckAccess(ctx, "session", "fingerprint"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// sessionStore - хранилище с отзываемыми сессиями. onCheck вызывается внутри каждой
+// проверки - так моделируется отзыв, пришедший, пока проверка идет в хранилище
+type sessionStore struct {
+	mu      sync.Mutex
+	revoked map[string]bool
+	calls   int
+	onCheck func()
+}
+
+func (s *sessionStore) CheckAccess(ctx context.Context, sessionID string, fingerprint string) (bool, error) {
+	s.mu.Lock()
+	s.calls++
+	valid := !s.revoked[sessionID]
+	onCheck := s.onCheck
+	s.mu.Unlock()
+
+	if onCheck != nil {
+		onCheck()
+	}
+
+	return valid, nil
+}
+
+func (s *sessionStore) revoke(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revoked[sessionID] = true
+}
+
+func TestRevokedSessionRejectedAfterForget(t *testing.T) {
+	tests := []struct {
+		name   string
+		forget bool
+		// want - ответ проверки сразу после отзыва
+		want bool
+	}{
+		// без Forget кеш отвечает прежним "не отозван" до истечения ttl - так отзыв
+		// видят другие экземпляры
+		{name: "other instance within ttl", forget: false, want: true},
+		{name: "same instance after Forget", forget: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &sessionStore{revoked: map[string]bool{}}
+			cache := New(store, time.Minute)
+			ctx := context.Background()
+
+			valid, err := cache.CheckAccess(ctx, "session", "fingerprint")
+			if err != nil || !valid {
+				t.Fatalf("CheckAccess() before revocation = %v, %v", valid, err)
+			}
+
+			store.revoke("session")
+			if tt.forget {
+				cache.Forget("session")
+			}
+
+			valid, err = cache.CheckAccess(ctx, "session", "fingerprint")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if valid != tt.want {
+				t.Fatalf("CheckAccess() after revocation = %v, want %v", valid, tt.want)
+			}
+		})
+	}
+}
+
+func TestForgetKeepsOtherSessions(t *testing.T) {
+	store := &sessionStore{revoked: map[string]bool{}}
+	cache := New(store, time.Minute)
+	ctx := context.Background()
+
+	for _, sessionID := range []string{"first", "second"} {
+		if _, err := cache.CheckAccess(ctx, sessionID, "fingerprint"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache.Forget("first")
+
+	for _, sessionID := range []string{"first", "second"} {
+		if _, err := cache.CheckAccess(ctx, sessionID, "fingerprint"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// заново в хранилище идет только забытая сессия
+	if store.calls != 3 {
+		t.Fatalf("storage calls = %d, want 3", store.calls)
+	}
+}
+
+func TestForgetDuringCheckIsNotCached(t *testing.T) {
+	store := &sessionStore{revoked: map[string]bool{}}
+	cache := New(store, time.Minute)
+	ctx := context.Background()
+
+	// хранилище ответило "не отозван", и тут же сессию отозвали
+	store.onCheck = func() {
+		store.onCheck = nil
+		store.revoke("session")
+		cache.Forget("session")
+	}
+
+	if _, err := cache.CheckAccess(ctx, "session", "fingerprint"); err != nil {
+		t.Fatal(err)
+	}
+
+	valid, err := cache.CheckAccess(ctx, "session", "fingerprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if valid {
+		t.Fatal("answer received before Forget was cached after it")
+	}
+}
@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"medods-test/internal/models"
+	"medods-test/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	ClientsTable          = "oauth_clients"
+	ClientSubjectsTable   = "client_subjects"
+	ClientIdColumn        = "client_id"
+	NameColumn            = "name"
+	SecretHashColumn      = "secret_hash"
+	TrustedColumn         = "trusted"
+	DisabledAtColumn      = "disabled_at"
+	PublicColumn          = "public"
+	RedirectURIsTable     = "client_redirect_uris"
+	RedirectURIColumn     = "redirect_uri"
+	TokenExchangeColumn   = "token_exchange"
+	AudiencesColumn       = "audiences"
+	DefaultAudienceColumn = "default_audience"
+	DefaultScopeColumn    = "default_scope"
+)
+
+func (s *PostgreStorage) FindClient(ctx context.Context, clientID string) (*models.Client, error) {
+	query := fmt.Sprintf(`
+	SELECT %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s IS NULL FROM %s
+	WHERE %s = $1
+	`, IdColumn, NameColumn, SecretHashColumn, TrustedColumn, ScopeColumn, PublicColumn,
+		TokenExchangeColumn, AudiencesColumn, DefaultAudienceColumn, DefaultScopeColumn, DisabledAtColumn,
+		ClientsTable,
+		IdColumn,
+	)
+
+	var client models.Client
+
+	err := s.conn.QueryRow(ctx, query, clientID).Scan(
+		&client.ID,
+		&client.Name,
+		&client.SecretHash,
+		&client.Trusted,
+		&client.Scope,
+		&client.Public,
+		&client.TokenExchange,
+		&client.Audiences,
+		&client.DefaultAudience,
+		&client.DefaultScope,
+		&client.IsActive,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrClientNotFound
+		}
+
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return &client, nil
+}
+
+// ClientHasSubject проверяет, что клиенту разрешено выпускать токены для guid
+func (s *PostgreStorage) ClientHasSubject(ctx context.Context, clientID string, guid string) (bool, error) {
+	var allowed bool
+
+	query := fmt.Sprintf(`
+	SELECT EXISTS (SELECT 1 FROM %s WHERE %s = $1 AND %s = $2)
+	`, ClientSubjectsTable, ClientIdColumn, GUIDColumn)
+
+	err := s.conn.QueryRow(ctx, query, clientID, guid).Scan(&allowed)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return false, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return allowed, nil
+}
+
+// SaveClient регистрирует клиента или обновляет секрет и доверие уже существующего
+func (s *PostgreStorage) SaveClient(ctx context.Context, client *models.Client) error {
+	query := fmt.Sprintf(`
+	INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s, %[5]s) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (%[2]s) DO UPDATE
+	SET %[3]s = EXCLUDED.%[3]s, %[4]s = EXCLUDED.%[4]s, %[5]s = EXCLUDED.%[5]s, %[6]s = NULL
+	`, ClientsTable,
+		IdColumn, NameColumn, SecretHashColumn, TrustedColumn, DisabledAtColumn,
+	)
+
+	_, err := s.conn.Exec(ctx, query, client.ID, client.Name, client.SecretHash, client.Trusted)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return nil
+}
+
+// ClientHasRedirectURI проверяет, что redirect_uri зарегистрирован у клиента. Сравнение точное
+func (s *PostgreStorage) ClientHasRedirectURI(ctx context.Context, clientID string, redirectURI string) (bool, error) {
+	var registered bool
+
+	query := fmt.Sprintf(`
+	SELECT EXISTS (SELECT 1 FROM %s WHERE %s = $1 AND %s = $2)
+	`, RedirectURIsTable, ClientIdColumn, RedirectURIColumn)
+
+	err := s.conn.QueryRow(ctx, query, clientID, redirectURI).Scan(&registered)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return false, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return registered, nil
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"medods-test/internal/models"
+	"medods-test/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	CodesTable          = "authorization_codes"
+	CodeHashColumn      = "code_hash"
+	CodeChallengeColumn = "code_challenge"
+	UsedAtColumn        = "used_at"
+	NonceColumn         = "nonce"
+)
+
+// SaveAuthorizationCode сохраняет код и заодно чистит коды, истекшие больше суток назад
+func (s *PostgreStorage) SaveAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	cleanup := fmt.Sprintf(`
+	DELETE FROM %s WHERE %s < NOW() - INTERVAL '1 day'
+	`, CodesTable, ExpiresColumn)
+
+	if _, err := s.conn.Exec(ctx, cleanup); err != nil {
+		s.log.Warn("failed to delete expired authorization codes", "err", err.Error())
+	}
+
+	query := fmt.Sprintf(`
+	INSERT INTO %s (%s, %s, %s, %s, %s, %s, %s, %s, %s)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, CodesTable,
+		CodeHashColumn, ClientIdColumn, GUIDColumn, RedirectURIColumn, ScopeColumn, CodeChallengeColumn, ExpiresColumn,
+		NonceColumn, AuthTimeColumn,
+	)
+
+	_, err := s.conn.Exec(ctx, query,
+		code.CodeHash,
+		code.ClientID,
+		code.GUID,
+		code.RedirectURI,
+		code.Scope,
+		code.CodeChallenge,
+		code.ExpiresAt,
+		code.Nonce,
+		code.AuthTime,
+	)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return nil
+}
+
+// ConsumeAuthorizationCode помечает код использованным и возвращает его. Пометка и
+// чтение - один UPDATE, поэтому из двух параллельных обменов одного кода пройдет только один.
+// Неизвестный или уже использованный код - ErrCodeNotFound. Срок действия проверяет вызывающий
+func (s *PostgreStorage) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	query := fmt.Sprintf(`
+	UPDATE %s SET %s = NOW()
+	WHERE %s = $1 AND %s IS NULL
+	RETURNING %s, %s, %s, %s, %s, %s, %s, %s, %s, %s
+	`, CodesTable, UsedAtColumn,
+		CodeHashColumn, UsedAtColumn,
+		CodeHashColumn, ClientIdColumn, GUIDColumn, RedirectURIColumn, ScopeColumn, CodeChallengeColumn, ExpiresColumn,
+		NonceColumn, AuthTimeColumn, CreatedColumn,
+	)
+
+	var code models.AuthorizationCode
+
+	err := s.conn.QueryRow(ctx, query, codeHash).Scan(
+		&code.CodeHash,
+		&code.ClientID,
+		&code.GUID,
+		&code.RedirectURI,
+		&code.Scope,
+		&code.CodeChallenge,
+		&code.ExpiresAt,
+		&code.Nonce,
+		&code.AuthTime,
+		&code.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrCodeNotFound
+		}
+
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return &code, nil
+}
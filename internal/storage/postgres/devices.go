@@ -0,0 +1,223 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"medods-test/internal/models"
+	"medods-test/internal/storage"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	DeviceCodesTable     = "device_codes"
+	DeviceCodeHashColumn = "device_code_hash"
+	UserCodeColumn       = "user_code"
+	StatusColumn         = "status"
+	PollIntervalColumn   = "poll_interval"
+	LastPolledAtColumn   = "last_polled_at"
+)
+
+var deviceCodeColumns = strings.Join([]string{
+	DeviceCodeHashColumn, UserCodeColumn, ClientIdColumn, ScopeColumn, StatusColumn,
+	"COALESCE(" + GUIDColumn + "::text, '')", AuthTimeColumn, PollIntervalColumn, LastPolledAtColumn, ExpiresColumn, CreatedColumn,
+}, ", ")
+
+// SaveDeviceCode сохраняет запрос авторизации устройства и чистит запросы, истекшие больше суток назад
+func (s *PostgreStorage) SaveDeviceCode(ctx context.Context, code *models.DeviceCode) error {
+	cleanup := fmt.Sprintf(`
+	DELETE FROM %s WHERE %s < NOW() - INTERVAL '1 day'
+	`, DeviceCodesTable, ExpiresColumn)
+
+	if _, err := s.conn.Exec(ctx, cleanup); err != nil {
+		s.log.Warn("failed to delete expired device codes", "err", err.Error())
+	}
+
+	query := fmt.Sprintf(`
+	INSERT INTO %s (%s, %s, %s, %s, %s, %s)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`, DeviceCodesTable,
+		DeviceCodeHashColumn, UserCodeColumn, ClientIdColumn, ScopeColumn, PollIntervalColumn, ExpiresColumn,
+	)
+
+	_, err := s.conn.Exec(ctx, query,
+		code.DeviceCodeHash,
+		code.UserCode,
+		code.ClientID,
+		code.Scope,
+		int(code.Interval.Seconds()),
+		code.ExpiresAt,
+	)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return nil
+}
+
+func (s *PostgreStorage) FindDeviceCodeByUserCode(ctx context.Context, userCode string) (*models.DeviceCode, error) {
+	query := fmt.Sprintf(`
+	SELECT %s FROM %s
+	WHERE %s = $1
+	`, deviceCodeColumns, DeviceCodesTable,
+		UserCodeColumn,
+	)
+
+	code, err := scanDeviceCode(s.conn.QueryRow(ctx, query, userCode))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrDeviceCodeNotFound
+		}
+
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return code, nil
+}
+
+// ResolveDeviceCode записывает решение пользователя по ожидающему и не истекшему запросу.
+// Для approved сохраняются пользователь, одобренные scopes и время входа.
+// Если запрос уже решен или истек - ErrDeviceCodeNotFound
+func (s *PostgreStorage) ResolveDeviceCode(ctx context.Context, code *models.DeviceCode) error {
+	query := fmt.Sprintf(`
+	UPDATE %s SET %s = $2, %s = NULLIF($3, '')::uuid, %s = $4, %s = $5
+	WHERE %s = $1 AND %s = '%s' AND %s > NOW()
+	`, DeviceCodesTable,
+		StatusColumn, GUIDColumn, ScopeColumn, AuthTimeColumn,
+		UserCodeColumn, StatusColumn, models.DeviceCodePending, ExpiresColumn,
+	)
+
+	var authTime *time.Time
+	if !code.AuthTime.IsZero() {
+		authTime = &code.AuthTime
+	}
+
+	tag, err := s.conn.Exec(ctx, query, code.UserCode, code.Status, code.GUID, code.Scope, authTime)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return storage.ErrDeviceCodeNotFound
+	}
+
+	return nil
+}
+
+// PollDeviceCode отмечает опрос устройства и возвращает запрос с временем предыдущего опроса
+func (s *PostgreStorage) PollDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceCode, error) {
+	query := fmt.Sprintf(`
+	UPDATE %[1]s d SET %[2]s = NOW()
+	FROM (SELECT %[2]s AS previous FROM %[1]s WHERE %[3]s = $1 FOR UPDATE) p
+	WHERE d.%[3]s = $1
+	RETURNING %[4]s
+	`, DeviceCodesTable, LastPolledAtColumn, DeviceCodeHashColumn,
+		strings.Replace(deviceCodeColumns, LastPolledAtColumn, "p.previous", 1),
+	)
+
+	code, err := scanDeviceCode(s.conn.QueryRow(ctx, query, deviceCodeHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrDeviceCodeNotFound
+		}
+
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return code, nil
+}
+
+// SlowDownDeviceCode увеличивает интервал опроса устройства на step (RFC 8628 3.5):
+// следующий опрос чаще нового интервала снова получит slow_down
+func (s *PostgreStorage) SlowDownDeviceCode(ctx context.Context, deviceCodeHash string, step time.Duration) error {
+	query := fmt.Sprintf(`
+	UPDATE %[1]s SET %[2]s = %[2]s + $2
+	WHERE %[3]s = $1
+	`, DeviceCodesTable, PollIntervalColumn, DeviceCodeHashColumn,
+	)
+
+	_, err := s.conn.Exec(ctx, query, deviceCodeHash, int(step.Seconds()))
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return nil
+}
+
+// ConsumeDeviceCode переводит одобренный запрос в used. Как и с кодом авторизации,
+// из двух параллельных опросов токены получит только один
+func (s *PostgreStorage) ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceCode, error) {
+	query := fmt.Sprintf(`
+	UPDATE %s SET %s = '%s'
+	WHERE %s = $1 AND %s = '%s'
+	RETURNING %s
+	`, DeviceCodesTable, StatusColumn, models.DeviceCodeUsed,
+		DeviceCodeHashColumn, StatusColumn, models.DeviceCodeApproved,
+		deviceCodeColumns,
+	)
+
+	code, err := scanDeviceCode(s.conn.QueryRow(ctx, query, deviceCodeHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrDeviceCodeNotFound
+		}
+
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return code, nil
+}
+
+func scanDeviceCode(row pgx.Row) (*models.DeviceCode, error) {
+	var (
+		code     models.DeviceCode
+		authTime *time.Time
+		interval int
+	)
+
+	err := row.Scan(
+		&code.DeviceCodeHash,
+		&code.UserCode,
+		&code.ClientID,
+		&code.Scope,
+		&code.Status,
+		&code.GUID,
+		&authTime,
+		&interval,
+		&code.LastPolledAt,
+		&code.ExpiresAt,
+		&code.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if authTime != nil {
+		code.AuthTime = *authTime
+	}
+
+	code.Interval = time.Duration(interval) * time.Second
+
+	return &code, nil
+}
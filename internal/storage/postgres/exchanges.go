@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"medods-test/internal/models"
+)
+
+const (
+	TokenExchangesTable = "token_exchanges"
+	SubjectColumn       = "subject"
+	ActorColumn         = "actor"
+	AudienceColumn      = "audience"
+)
+
+// SaveTokenExchange пишет обмен токена в журнал. Токен выдается только после записи
+func (s *PostgreStorage) SaveTokenExchange(ctx context.Context, exchange *models.TokenExchange) error {
+	query := fmt.Sprintf(`
+	INSERT INTO %s (%s, %s, %s, %s, %s, %s, %s)
+	VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, $6, $7)
+	`, TokenExchangesTable,
+		JtiColumn, ClientIdColumn, SubjectColumn, ActorColumn, SessionIdColumn, ScopeColumn, AudienceColumn,
+	)
+
+	_, err := s.conn.Exec(ctx, query,
+		exchange.JTI,
+		exchange.ClientID,
+		exchange.Subject,
+		exchange.Actor,
+		exchange.SessionID,
+		exchange.Scope,
+		exchange.Audience,
+	)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return nil
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"medods-test/internal/models"
 	"medods-test/internal/storage"
 	"time"
 
@@ -15,21 +14,35 @@ import (
 )
 
 const (
-	TokensTable         = "ref_tokens"
+	SessionsTable       = "sessions"
 	IdColumn            = "id"
 	GUIDColumn          = "guid"
 	RefTokenHashColumn  = "token_hash"
 	UserAgentHashColumn = "user_agent_hash"
 	IpHashColumn        = "ip_hash"
+	DeviceColumn        = "device"
+	LocationColumn      = "location"
+	ScopeColumn         = "scope"
 	CreatedColumn       = "created_at"
 	UpdatedColum        = "updated_at"
-	IsActivatedColumn   = "is_activated"
+	ExpiresColumn       = "expires_at"
+	RevokedAtColumn     = "revoked_at"
+	AuthTimeColumn      = "auth_time"
 )
 
 const (
-	BlackListTable  = "blacklist_used_tokens"
-	IdRefColumn     = "id_ref_tokens"
-	UsedTokenColumn = "used_token"
+	RolesTable      = "roles"
+	RoleScopesTable = "role_scopes"
+	UserRolesTable  = "user_roles"
+	RoleNameColumn  = "name"
+	RoleColumn      = "role"
+	IsDefaultColumn = "is_default"
+)
+
+const (
+	BlackListTable    = "blacklist_used_tokens"
+	SessionIdColumn   = "session_id"
+	FingerprintColumn = "fingerprint"
 )
 
 var (
@@ -85,313 +98,137 @@ func (s *PostgreStorage) Ping(ctx context.Context) error {
 	return nil
 }
 
-func (s *PostgreStorage) SaveUserInfo(ctx context.Context, UserInfo *models.UserInfo) (int, error) {
-	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		s.log.Error(ErrTxBegin.Error(), "err", err.Error())
-
-		return 0, fmt.Errorf("%w:%w", ErrTxBegin, err)
-	}
-
-	tx.Begin(ctx)
-	defer tx.Rollback(ctx)
-
-	query := fmt.Sprintf(`
-	INSERT INTO %s
-	(%s, %s, %s, %s) VALUES ($1, $2, $3, $4) 
-	RETURNING id
-	`, TokensTable,
-		GUIDColumn, RefTokenHashColumn, UserAgentHashColumn, IpHashColumn,
-	)
-
-	var id int
-
-	err = s.conn.QueryRow(ctx, query,
-		UserInfo.GUID,
-		UserInfo.TokenHash,
-		UserInfo.UserAgentHash,
-		UserInfo.IPhash).Scan(&id)
-	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok {
-			if pgErr.Code == "23505" {
-				s.log.Error(storage.ErrGuidExists.Error(), "err", err.Error())
-				s.log.Debug(storage.ErrGuidExists.Error(), "err", err.Error(), "query", query)
-
-				return 0, storage.ErrGuidExists
-
-			}
-		}
-
-		s.log.Error(ErrQuery.Error(), "err", err.Error())
-		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
-
-		return 0, fmt.Errorf("%s:%w", ErrQuery, err)
-	}
-
-	err = tx.Commit(ctx)
-	if err != nil {
-		s.log.Error(ErrTxCommit.Error(), "err", err.Error())
-		s.log.Debug(ErrTxCommit.Error(), "err", err.Error(), "query", query)
-
-		return 0, fmt.Errorf("%s:%w", ErrTxCommit, err)
-	}
-
-	return id, nil
-
+// execer - общее у пула и транзакции, чтобы одни и те же запросы работали в обоих
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
 }
 
-func (s *PostgreStorage) IsActive(ctx context.Context, guid string) (bool, error) {
-	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		s.log.Error(ErrTxBegin.Error(), "err", err.Error())
-
-		return false, fmt.Errorf("%w:%w", ErrTxBegin, err)
-	}
-
-	tx.Begin(ctx)
-	defer tx.Rollback(ctx)
-
-	var IsActive bool
-
-	query := fmt.Sprintf(`
-	SELECT %s FROM %s
-	WHERE %s = $1`,
-		IsActivatedColumn,
-		TokensTable,
-		GUIDColumn)
-
-	err = s.conn.QueryRow(ctx, query, guid).Scan(&IsActive)
-	if err != nil {
-		s.log.Error(ErrQuery.Error(), "err", err.Error())
-		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
-
-		return false, fmt.Errorf("%s:%w", ErrQuery, err)
-	}
-
-	err = tx.Commit(ctx)
-	if err != nil {
-		s.log.Error(ErrTxCommit.Error(), "err", err.Error())
-		s.log.Debug(ErrTxCommit.Error(), "err", err.Error(), "query", query)
-
-		return false, fmt.Errorf("%s:%w", ErrTxCommit, err)
-	}
-	return IsActive, nil
+func (s *PostgreStorage) BlockToken(ctx context.Context, fingerprint string, sessionID string) error {
+	return s.blockTokens(ctx, s.conn, sessionID, fingerprint)
 }
 
-func (s *PostgreStorage) BlockToken(ctx context.Context, hashedToken string, idToken string) error {
-	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		s.log.Error(ErrTxBegin.Error(), "err", err.Error())
-
-		return fmt.Errorf("%w:%w", ErrTxBegin, err)
-	}
-
+// blockTokens добавляет отпечатки в черный список. Уже заблокированный токен - не ошибка.
+// Пустой sessionID - токен без сессии (сервисный токен client_credentials)
+func (s *PostgreStorage) blockTokens(ctx context.Context, db execer, sessionID string, fingerprints ...string) error {
 	query := fmt.Sprintf(`
 	INSERT INTO %s (%s,%s)
-	VALUES ($1, $2)`,
+	VALUES (NULLIF($1, '')::uuid, $2)
+	ON CONFLICT (%s) DO NOTHING`,
 		BlackListTable,
-		IdRefColumn,
-		UsedTokenColumn,
+		SessionIdColumn,
+		FingerprintColumn,
+		FingerprintColumn,
 	)
 
-	_, err = s.conn.Exec(ctx, query, idToken, hashedToken)
-	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok {
-			if pgErr.Code == "23505" {
-				s.log.Warn(storage.ErrTokenUsedExsits.Error())
-				s.log.Debug(storage.ErrGuidExists.Error(), "err", err.Error(), "query", query)
-			}
-		} else {
+	for _, fingerprint := range fingerprints {
+		tag, err := db.Exec(ctx, query, sessionID, fingerprint)
+		if err != nil {
+			s.log.Error(ErrQuery.Error(), "err", err.Error())
+			s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
 			return fmt.Errorf("%w:%w", ErrQuery, err)
 		}
 
+		if tag.RowsAffected() == 0 {
+			s.log.Warn(storage.ErrTokenUsedExsits.Error())
+		}
 	}
 
-	err = tx.Commit(ctx)
-	if err != nil {
-		s.log.Error(ErrTxCommit.Error(), "err", err.Error())
-		s.log.Debug(ErrTxCommit.Error(), "err", err.Error(), "query", query)
-
-		return fmt.Errorf("%s:%w", ErrTxCommit, err)
-	}
 	return nil
-
 }
 
-func (s *PostgreStorage) IsBlocked(ctx context.Context, hashedToken string) (bool, error) {
-	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		s.log.Error(ErrTxBegin.Error(), "err", err.Error())
-
-		return false, fmt.Errorf("%w:%w", ErrTxBegin, err)
-	}
-
-	blocked := false
-	var count int
+func (s *PostgreStorage) IsBlocked(ctx context.Context, fingerprint string) (bool, error) {
+	var blocked bool
 
 	query := fmt.Sprintf(`
-	SELECT COUNT(*) FROM %s
-	WHERE %s = $1
+	SELECT EXISTS (SELECT 1 FROM %s WHERE %s = $1)
 	`, BlackListTable,
-		UsedTokenColumn,
+		FingerprintColumn,
 	)
 
-	err = s.conn.QueryRow(ctx, query, hashedToken).Scan(&count)
+	err := s.conn.QueryRow(ctx, query, fingerprint).Scan(&blocked)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			blocked = false
-		} else {
-			return false, fmt.Errorf("%w:%w", ErrQuery, err)
-		}
-
-	}
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
 
-	if count > 0 {
-		blocked = true
+		return false, fmt.Errorf("%w:%w", ErrQuery, err)
 	}
 
-	err = tx.Commit(ctx)
-	if err != nil {
-		s.log.Error(ErrTxCommit.Error(), "err", err.Error())
-		s.log.Debug(ErrTxCommit.Error(), "err", err.Error(), "query", query)
-
-		return false, fmt.Errorf("%s:%w", ErrTxCommit, err)
-	}
 	return blocked, nil
 }
 
-func (s *PostgreStorage) FindByGUID(ctx context.Context, guid string) (*models.UserInfo, int, error) {
+// RekeyBlacklist переводит на отпечатки записи черного списка, в которые раньше
+// попадал сам access токен. Миграция этого сделать не может - у нее нет ключа HMAC.
+// Если токен уже заблокирован и по отпечатку, старая запись просто удаляется:
+// fingerprint уникален. Все записи переводятся в одной транзакции.
+// Отпечатки - hex строки без точек, поэтому повторный запуск ничего не меняет
+func (s *PostgreStorage) RekeyBlacklist(ctx context.Context, fingerprint func(token string) string) (int, error) {
 	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		s.log.Error(ErrTxBegin.Error(), "err", err.Error())
 
-		return nil, 0, fmt.Errorf("%w:%w", ErrTxBegin, err)
+		return 0, fmt.Errorf("%w:%w", ErrTxBegin, err)
 	}
 
-	var UserInfo models.UserInfo
-	var id int
+	defer tx.Rollback(ctx)
 
 	query := fmt.Sprintf(`
-	SELECT %s, %s,%s,%s,%s FROM %s
-	WHERE %s = $1
-	`, IdColumn, GUIDColumn, RefTokenHashColumn, UserAgentHashColumn, IpHashColumn,
-		TokensTable,
-		GUIDColumn,
-	)
-
-	err = s.conn.QueryRow(ctx, query, guid).Scan(
-		&id,
-		&UserInfo.GUID,
-		&UserInfo.TokenHash,
-		&UserInfo.UserAgentHash,
-		&UserInfo.IPhash,
+	SELECT %s FROM %s
+	WHERE %s LIKE '%%.%%'
+	FOR UPDATE
+	`, FingerprintColumn, BlackListTable,
+		FingerprintColumn,
 	)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			s.log.Error("GUID not found")
-
-			return nil, 0, fmt.Errorf("GUID not found:%w", err)
-		} else {
-			s.log.Error(ErrQuery.Error(), "error", err.Error())
-			return nil, 0, fmt.Errorf("%w:%w", ErrQuery, err)
-		}
-
-	}
 
-	err = tx.Commit(ctx)
+	rows, err := tx.Query(ctx, query)
 	if err != nil {
-		s.log.Error(ErrTxCommit.Error(), "err", err.Error())
-		s.log.Debug(ErrTxCommit.Error(), "err", err.Error(), "query", query)
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
 
-		return nil, 0, fmt.Errorf("%s:%w", ErrTxCommit, err)
+		return 0, fmt.Errorf("%w:%w", ErrQuery, err)
 	}
 
-	return &UserInfo, id, nil
-}
-
-func (s *PostgreStorage) Logout(ctx context.Context, guid string) error {
-	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{})
+	tokens, err := pgx.CollectRows(rows, pgx.RowTo[string])
 	if err != nil {
-		s.log.Error(ErrTxBegin.Error(), "err", err.Error())
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
 
-		return fmt.Errorf("%w:%w", ErrTxBegin, err)
+		return 0, fmt.Errorf("%w:%w", ErrQuery, err)
 	}
 
-	query := fmt.Sprintf(`
-	UPDATE %s
-	SET %s = FALSE
-	WHERE %s = $1`,
-		TokensTable,
-		IsActivatedColumn,
-		GUIDColumn,
+	insert := fmt.Sprintf(`
+	INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s)
+	SELECT $1, %[3]s, %[4]s FROM %[1]s WHERE %[2]s = $2
+	ON CONFLICT (%[2]s) DO NOTHING
+	`, BlackListTable, FingerprintColumn, SessionIdColumn, CreatedColumn,
 	)
 
-	_, err = s.conn.Exec(ctx, query, guid)
+	remove := fmt.Sprintf(`
+	DELETE FROM %s
+	WHERE %s = $1
+	`, BlackListTable, FingerprintColumn,
+	)
 
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			s.log.Error("GUID not found")
+	for _, token := range tokens {
+		if _, err := tx.Exec(ctx, insert, fingerprint(token), token); err != nil {
+			s.log.Error(ErrQuery.Error(), "err", err.Error())
+			s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", insert)
 
-			return fmt.Errorf("GUID not found:%w", err)
-		} else {
-			s.log.Error(ErrQuery.Error(), "error", err.Error())
-			return fmt.Errorf("%w:%w", ErrQuery, err)
+			return 0, fmt.Errorf("%w:%w", ErrQuery, err)
 		}
 
-	}
-
-	err = tx.Commit(ctx)
-	if err != nil {
-		s.log.Error(ErrTxCommit.Error(), "err", err.Error())
-		s.log.Debug(ErrTxCommit.Error(), "err", err.Error(), "query", query)
-
-		return fmt.Errorf("%s:%w", ErrTxCommit, err)
-	}
-
-	return nil
-}
-
-func (s *PostgreStorage) UpdateUserInfo(ctx context.Context, UserInfo *models.UserInfo) error {
-	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		s.log.Error(ErrTxBegin.Error(), "err", err.Error())
-
-		return fmt.Errorf("%w:%w", ErrTxBegin, err)
-	}
-
-	tx.Begin(ctx)
-	defer tx.Rollback(ctx)
+		if _, err := tx.Exec(ctx, remove, token); err != nil {
+			s.log.Error(ErrQuery.Error(), "err", err.Error())
+			s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", remove)
 
-	query := fmt.Sprintf(`
-	UPDATE %s
-	SET %s = $1, %s = $2, %s = $3
-	WHERE %s = $4
-	`, TokensTable,
-		RefTokenHashColumn, UserAgentHashColumn, IpHashColumn,
-		GUIDColumn,
-	)
-
-	_, err = s.conn.Exec(ctx, query,
-		UserInfo.TokenHash,
-		UserInfo.UserAgentHash,
-		UserInfo.IPhash,
-		UserInfo.GUID)
-	if err != nil {
-
-		s.log.Error(ErrQuery.Error(), "err", err.Error())
-		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
-
-		return fmt.Errorf("%s:%w", ErrQuery, err)
+			return 0, fmt.Errorf("%w:%w", ErrQuery, err)
+		}
 	}
 
-	err = tx.Commit(ctx)
-	if err != nil {
+	if err := tx.Commit(ctx); err != nil {
 		s.log.Error(ErrTxCommit.Error(), "err", err.Error())
-		s.log.Debug(ErrTxCommit.Error(), "err", err.Error(), "query", query)
 
-		return fmt.Errorf("%s:%w", ErrTxCommit, err)
+		return 0, fmt.Errorf("%w:%w", ErrTxCommit, err)
 	}
 
-	return nil
-
+	return len(tokens), nil
 }
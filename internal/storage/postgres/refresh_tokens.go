@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"medods-test/internal/models"
+	"medods-test/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	RefreshTokensTable = "refresh_tokens"
+	ParentIdColumn     = "parent_id"
+	TokenHashColumn    = "token_hash"
+	RotatedAtColumn    = "rotated_at"
+	JtiColumn          = "jti"
+	JktColumn          = "jkt"
+)
+
+func insertRefreshToken(ctx context.Context, tx pgx.Tx, sessionID string, parentID *int, tokenHash string, jti string, jkt string) error {
+	query := fmt.Sprintf(`
+	INSERT INTO %s (%s, %s, %s, %s, %s) VALUES ($1, $2, $3, $4, $5)
+	`, RefreshTokensTable,
+		SessionIdColumn, ParentIdColumn, TokenHashColumn, JtiColumn, JktColumn,
+	)
+
+	_, err := tx.Exec(ctx, query, sessionID, parentID, tokenHash, jti, jkt)
+
+	return err
+}
+
+// FindRefreshToken ищет refresh токен среди всех выданных, в том числе уже замененных
+func (s *PostgreStorage) FindRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	return s.findRefreshToken(ctx, TokenHashColumn, tokenHash)
+}
+
+// FindRefreshTokenByJTI ищет refresh токен по jti - его содержит claim rti парного access токена
+func (s *PostgreStorage) FindRefreshTokenByJTI(ctx context.Context, jti string) (*models.RefreshToken, error) {
+	if _, err := uuid.Parse(jti); err != nil {
+		return nil, storage.ErrTokenNotFound
+	}
+
+	return s.findRefreshToken(ctx, JtiColumn, jti)
+}
+
+func (s *PostgreStorage) findRefreshToken(ctx context.Context, column string, value string) (*models.RefreshToken, error) {
+	query := fmt.Sprintf(`
+	SELECT t.%s, t.%s, t.%s, t.%s, t.%s, t.%s, t.%s, t.%s, s.%s, s.%s
+	FROM %s t JOIN %s s ON s.%s = t.%s
+	WHERE t.%s = $1
+	`, IdColumn, JtiColumn, JktColumn, SessionIdColumn, ParentIdColumn, TokenHashColumn, RotatedAtColumn, CreatedColumn,
+		GUIDColumn, RevokedAtColumn,
+		RefreshTokensTable, SessionsTable, IdColumn, SessionIdColumn,
+		column,
+	)
+
+	var token models.RefreshToken
+
+	err := s.conn.QueryRow(ctx, query, value).Scan(
+		&token.ID,
+		&token.JTI,
+		&token.JKT,
+		&token.SessionID,
+		&token.ParentID,
+		&token.TokenHash,
+		&token.RotatedAt,
+		&token.CreatedAt,
+		&token.GUID,
+		&token.SessionRevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrTokenNotFound
+		}
+
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return &token, nil
+}
+
+// rotateRefreshToken помечает parent замененным и добавляет в семейство потомка.
+// Если parent уже был заменен (в том числе параллельным запросом), возвращает ErrTokenReused
+func rotateRefreshToken(ctx context.Context, tx pgx.Tx, parent *models.RefreshToken, tokenHash string, jti string, jkt string) error {
+	query := fmt.Sprintf(`
+	UPDATE %s SET %s = CURRENT_TIMESTAMP
+	WHERE %s = $1 AND %s IS NULL
+	`, RefreshTokensTable, RotatedAtColumn,
+		IdColumn, RotatedAtColumn,
+	)
+
+	tag, err := tx.Exec(ctx, query, parent.ID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return storage.ErrTokenReused
+	}
+
+	return insertRefreshToken(ctx, tx, parent.SessionID, &parent.ID, tokenHash, jti, jkt)
+}
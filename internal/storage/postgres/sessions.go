@@ -0,0 +1,449 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"medods-test/internal/models"
+	"medods-test/internal/storage"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var sessionColumns = strings.Join([]string{
+	IdColumn, GUIDColumn, RefTokenHashColumn, UserAgentHashColumn, IpHashColumn,
+	DeviceColumn, LocationColumn, ScopeColumn, "COALESCE(" + ClientIdColumn + ", '')", RevokedAtColumn + " IS NULL", ExpiresColumn, AuthTimeColumn, CreatedColumn, UpdatedColum,
+}, ", ")
+
+// SaveSession сохраняет новую сессию и первый refresh токен ее семейства с jti refreshJTI.
+// jkt - отпечаток DPoP ключа, к которому привязана выданная пара, пустой если привязки нет
+func (s *PostgreStorage) SaveSession(ctx context.Context, session *models.Session, refreshJTI string, jkt string) error {
+	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		s.log.Error(ErrTxBegin.Error(), "err", err.Error())
+
+		return fmt.Errorf("%w:%w", ErrTxBegin, err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	query := fmt.Sprintf(`
+	INSERT INTO %s
+	(%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11)
+	`, SessionsTable,
+		IdColumn, GUIDColumn, RefTokenHashColumn, UserAgentHashColumn, IpHashColumn,
+		DeviceColumn, LocationColumn, ScopeColumn, ExpiresColumn, ClientIdColumn, AuthTimeColumn,
+	)
+
+	_, err = tx.Exec(ctx, query,
+		session.ID,
+		session.GUID,
+		session.TokenHash,
+		session.UserAgentHash,
+		session.IPhash,
+		session.Device,
+		session.Location,
+		session.Scope,
+		session.ExpiresAt,
+		session.ClientID,
+		session.AuthTime)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return fmt.Errorf("%s:%w", ErrQuery, err)
+	}
+
+	err = insertRefreshToken(ctx, tx, session.ID, nil, session.TokenHash, refreshJTI, jkt)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+
+		return fmt.Errorf("%s:%w", ErrQuery, err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		s.log.Error(ErrTxCommit.Error(), "err", err.Error())
+		s.log.Debug(ErrTxCommit.Error(), "err", err.Error(), "query", query)
+
+		return fmt.Errorf("%s:%w", ErrTxCommit, err)
+	}
+
+	return nil
+}
+
+func (s *PostgreStorage) FindSession(ctx context.Context, sessionID string) (*models.Session, error) {
+	query := fmt.Sprintf(`
+	SELECT %s FROM %s
+	WHERE %s = $1
+	`, sessionColumns,
+		SessionsTable,
+		IdColumn,
+	)
+
+	session, err := scanSession(s.conn.QueryRow(ctx, query, sessionID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrSessionNotFound
+		}
+
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return session, nil
+}
+
+// FindSessionByTokenHash ищет сессию по HMAC хешу ее текущего refresh токена
+func (s *PostgreStorage) FindSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	query := fmt.Sprintf(`
+	SELECT %s FROM %s
+	WHERE %s = $1
+	`, sessionColumns,
+		SessionsTable,
+		RefTokenHashColumn,
+	)
+
+	session, err := scanSession(s.conn.QueryRow(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrTokenNotFound
+		}
+
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return session, nil
+}
+
+// CheckAccess за один запрос проверяет, что сессия открыта, а токен с отпечатком
+// fingerprint не в черном списке
+func (s *PostgreStorage) CheckAccess(ctx context.Context, sessionID string, fingerprint string) (bool, error) {
+	// у сервисных токенов client_credentials нет сессии - для них проверяется только черный список
+	if sessionID == "" {
+		blocked, err := s.IsBlocked(ctx, fingerprint)
+
+		return !blocked, err
+	}
+
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return false, nil
+	}
+
+	var valid bool
+
+	query := fmt.Sprintf(`
+	SELECT EXISTS (SELECT 1 FROM %s WHERE %s = $1 AND %s IS NULL)
+		AND NOT EXISTS (SELECT 1 FROM %s WHERE %s = $2)`,
+		SessionsTable, IdColumn, RevokedAtColumn,
+		BlackListTable, FingerprintColumn,
+	)
+
+	err := s.conn.QueryRow(ctx, query, sessionID, fingerprint).Scan(&valid)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return false, fmt.Errorf("%s:%w", ErrQuery, err)
+	}
+
+	return valid, nil
+}
+
+// RotateSession в одной транзакции выполняет обмен refresh токена: заменяет
+// rotation.Parent потомком, блокирует старые токены и сохраняет новое состояние сессии.
+// Строка сессии блокируется FOR UPDATE, так что ротации одной сессии идут строго по очереди.
+// Если parent уже заменен - ErrTokenReused, если сессию успели закрыть - ErrSessionNotFound;
+// в обоих случаях ничего не меняется
+func (s *PostgreStorage) RotateSession(ctx context.Context, rotation *models.Rotation) error {
+	session := rotation.Session
+
+	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		s.log.Error(ErrTxBegin.Error(), "err", err.Error())
+
+		return fmt.Errorf("%w:%w", ErrTxBegin, err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	lock := fmt.Sprintf(`
+	SELECT %s FROM %s
+	WHERE %s = $1 AND %s IS NULL
+	FOR UPDATE
+	`, IdColumn, SessionsTable,
+		IdColumn, RevokedAtColumn,
+	)
+
+	var locked string
+
+	err = tx.QueryRow(ctx, lock, session.ID).Scan(&locked)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storage.ErrSessionNotFound
+		}
+
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", lock)
+
+		return fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	err = rotateRefreshToken(ctx, tx, rotation.Parent, session.TokenHash, rotation.RefreshJTI, rotation.JKT)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenReused) {
+			return err
+		}
+
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+
+		return fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	if err := s.blockTokens(ctx, tx, session.ID, rotation.Blocked...); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET %s = $1, %s = $2, %s = $3, %s = $4, %s = $5, %s = $6, %s = CURRENT_TIMESTAMP
+	WHERE %s = $7
+	`, SessionsTable,
+		RefTokenHashColumn, UserAgentHashColumn, IpHashColumn, DeviceColumn, LocationColumn, ExpiresColumn, UpdatedColum,
+		IdColumn,
+	)
+
+	_, err = tx.Exec(ctx, query,
+		session.TokenHash,
+		session.UserAgentHash,
+		session.IPhash,
+		session.Device,
+		session.Location,
+		session.ExpiresAt,
+		session.ID)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "err", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return fmt.Errorf("%s:%w", ErrQuery, err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		s.log.Error(ErrTxCommit.Error(), "err", err.Error())
+
+		return fmt.Errorf("%s:%w", ErrTxCommit, err)
+	}
+
+	return nil
+}
+
+// RevokeSession закрывает сессию. Refresh токены ее семейства и выданные по ней
+// access токены перестают приниматься
+func (s *PostgreStorage) RevokeSession(ctx context.Context, sessionID string) error {
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET %s = CURRENT_TIMESTAMP
+	WHERE %s = $1 AND %s IS NULL`,
+		SessionsTable,
+		RevokedAtColumn,
+		IdColumn, RevokedAtColumn,
+	)
+
+	_, err := s.conn.Exec(ctx, query, sessionID)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return nil
+}
+
+// ListSessions возвращает активные и не истекшие сессии пользователя, от недавно обновленных к старым
+func (s *PostgreStorage) ListSessions(ctx context.Context, guid string) ([]*models.Session, error) {
+	query := fmt.Sprintf(`
+	SELECT %s FROM %s
+	WHERE %s = $1 AND %s IS NULL AND %s > CURRENT_TIMESTAMP
+	ORDER BY %s DESC
+	`, sessionColumns,
+		SessionsTable,
+		GUIDColumn, RevokedAtColumn, ExpiresColumn,
+		UpdatedColum,
+	)
+
+	rows, err := s.conn.Query(ctx, query, guid)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			s.log.Error(ErrQuery.Error(), "error", err.Error())
+
+			return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+
+		return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeUserSession закрывает сессию, только если она принадлежит пользователю guid.
+// Чужая или уже закрытая сессия дает ErrSessionNotFound
+func (s *PostgreStorage) RevokeUserSession(ctx context.Context, guid string, sessionID string) error {
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET %s = CURRENT_TIMESTAMP
+	WHERE %s = $1 AND %s = $2 AND %s IS NULL`,
+		SessionsTable,
+		RevokedAtColumn,
+		IdColumn, GUIDColumn, RevokedAtColumn,
+	)
+
+	tag, err := s.conn.Exec(ctx, query, sessionID, guid)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return storage.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions закрывает все сессии пользователя, кроме keepSessionID.
+// Возвращает число закрытых сессий
+func (s *PostgreStorage) RevokeOtherSessions(ctx context.Context, guid string, keepSessionID string) (int64, error) {
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET %s = CURRENT_TIMESTAMP
+	WHERE %s = $1 AND %s <> $2 AND %s IS NULL`,
+		SessionsTable,
+		RevokedAtColumn,
+		GUIDColumn, IdColumn, RevokedAtColumn,
+	)
+
+	tag, err := s.conn.Exec(ctx, query, guid, keepSessionID)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return 0, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func scanSession(row pgx.Row) (*models.Session, error) {
+	var session models.Session
+
+	err := row.Scan(
+		&session.ID,
+		&session.GUID,
+		&session.TokenHash,
+		&session.UserAgentHash,
+		&session.IPhash,
+		&session.Device,
+		&session.Location,
+		&session.Scope,
+		&session.ClientID,
+		&session.IsActive,
+		&session.ExpiresAt,
+		&session.AuthTime,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// UserPermissions возвращает роли пользователя и разрешенные ими scopes.
+// Если ролей у пользователя нет, действуют роли по умолчанию
+func (s *PostgreStorage) UserPermissions(ctx context.Context, guid string) (*models.Permissions, error) {
+	query := fmt.Sprintf(`
+	WITH assigned AS (
+		SELECT %[1]s FROM %[2]s WHERE %[3]s = $1
+	), effective AS (
+		SELECT %[1]s FROM assigned
+		UNION
+		SELECT %[4]s FROM %[5]s WHERE %[6]s AND NOT EXISTS (SELECT 1 FROM assigned)
+	)
+	SELECT e.%[1]s, rs.%[7]s
+	FROM effective e LEFT JOIN %[8]s rs ON rs.%[1]s = e.%[1]s
+	`, RoleColumn, UserRolesTable, GUIDColumn,
+		RoleNameColumn, RolesTable, IsDefaultColumn,
+		ScopeColumn, RoleScopesTable,
+	)
+
+	rows, err := s.conn.Query(ctx, query, guid)
+	if err != nil {
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+		s.log.Debug(ErrQuery.Error(), "err", err.Error(), "query", query)
+
+		return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+	defer rows.Close()
+
+	var permissions models.Permissions
+
+	for rows.Next() {
+		var role string
+		var scope *string
+
+		if err := rows.Scan(&role, &scope); err != nil {
+			s.log.Error(ErrQuery.Error(), "error", err.Error())
+
+			return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+		}
+
+		permissions.Roles = append(permissions.Roles, role)
+		if scope != nil {
+			permissions.Scopes = append(permissions.Scopes, *scope)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		s.log.Error(ErrQuery.Error(), "error", err.Error())
+
+		return nil, fmt.Errorf("%w:%w", ErrQuery, err)
+	}
+
+	slices.Sort(permissions.Roles)
+	permissions.Roles = slices.Compact(permissions.Roles)
+
+	slices.Sort(permissions.Scopes)
+	permissions.Scopes = slices.Compact(permissions.Scopes)
+
+	return &permissions, nil
+}
@@ -4,21 +4,47 @@ import (
 	"context"
 	"errors"
 	"medods-test/internal/models"
+	"time"
 )
 
 var (
-	ErrGuidExists      = errors.New("GUID is already exists")
-	ErrTokenUsedExsits = errors.New("token is alredy exists")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrTokenUsedExsits    = errors.New("token is alredy exists")
+	ErrTokenNotFound      = errors.New("token not found")
+	ErrTokenReused        = errors.New("refresh token is already rotated")
+	ErrClientNotFound     = errors.New("client not found")
+	ErrCodeNotFound       = errors.New("authorization code not found or already used")
+	ErrDeviceCodeNotFound = errors.New("device code not found or already resolved")
 )
 
 type Storage interface {
 	Close()
 	Ping(ctx context.Context) error
-	SaveUserInfo(ctx context.Context, UserInfo *models.UserInfo) (int, error)
-	UpdateUserInfo(ctx context.Context, UserInfo *models.UserInfo) error
-	IsActive(ctx context.Context, guid string) (bool, error)
-	Logout(ctx context.Context, guid string) error
-	BlockToken(ctx context.Context, hashedToken string, idToken string) error
-	IsBlocked(ctx context.Context, hashedToken string) (bool, error)
-	FindByGUID(ctx context.Context, guid string) (*models.UserInfo, int, error)
+	SaveSession(ctx context.Context, session *models.Session, refreshJTI string, jkt string) error
+	FindSession(ctx context.Context, sessionID string) (*models.Session, error)
+	FindSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error)
+	CheckAccess(ctx context.Context, sessionID string, fingerprint string) (bool, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	UserPermissions(ctx context.Context, guid string) (*models.Permissions, error)
+	FindClient(ctx context.Context, clientID string) (*models.Client, error)
+	ClientHasSubject(ctx context.Context, clientID string, guid string) (bool, error)
+	SaveClient(ctx context.Context, client *models.Client) error
+	ClientHasRedirectURI(ctx context.Context, clientID string, redirectURI string) (bool, error)
+	SaveAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error)
+	SaveDeviceCode(ctx context.Context, code *models.DeviceCode) error
+	FindDeviceCodeByUserCode(ctx context.Context, userCode string) (*models.DeviceCode, error)
+	ResolveDeviceCode(ctx context.Context, code *models.DeviceCode) error
+	PollDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceCode, error)
+	SlowDownDeviceCode(ctx context.Context, deviceCodeHash string, step time.Duration) error
+	ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceCode, error)
+	SaveTokenExchange(ctx context.Context, exchange *models.TokenExchange) error
+	ListSessions(ctx context.Context, guid string) ([]*models.Session, error)
+	RevokeUserSession(ctx context.Context, guid string, sessionID string) error
+	RevokeOtherSessions(ctx context.Context, guid string, keepSessionID string) (int64, error)
+	BlockToken(ctx context.Context, fingerprint string, sessionID string) error
+	IsBlocked(ctx context.Context, fingerprint string) (bool, error)
+	FindRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	FindRefreshTokenByJTI(ctx context.Context, jti string) (*models.RefreshToken, error)
+	RotateSession(ctx context.Context, rotation *models.Rotation) error
 }
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- refresh токены стали непрозрачными и хешируются HMAC. Старые bcrypt хеши
+-- найти по токену нельзя, поэтому такие сессии закрываются
+UPDATE ref_tokens SET is_activated = FALSE;
+
+ALTER TABLE ref_tokens
+    ADD COLUMN expires_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE UNIQUE INDEX ref_tokens_token_hash_idx ON ref_tokens (token_hash);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX ref_tokens_token_hash_idx;
+
+ALTER TABLE ref_tokens DROP COLUMN expires_at;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- каждый вход открывает семейство refresh токенов, каждая ротация добавляет в него потомка.
+-- Повторное предъявление уже замененного токена отзывает все семейство
+CREATE TABLE token_families (
+    id UUID PRIMARY KEY,
+    guid UUID NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    family_id UUID NOT NULL REFERENCES token_families(id) ON DELETE CASCADE,
+    parent_id INT REFERENCES refresh_tokens(id),
+    token_hash VARCHAR UNIQUE NOT NULL,
+    rotated_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+ALTER TABLE ref_tokens ADD COLUMN family_id UUID REFERENCES token_families(id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE ref_tokens DROP COLUMN family_id;
+DROP TABLE refresh_tokens CASCADE;
+DROP TABLE token_families CASCADE;
+-- +goose StatementEnd
@@ -0,0 +1,96 @@
+-- +goose Up
+-- +goose StatementBegin
+-- у пользователя может быть несколько сессий (телефон, ноутбук), поэтому
+-- ref_tokens с guid UNIQUE заменяется таблицей sessions. Семейство refresh токенов
+-- теперь и есть сессия: id семейства становится id сессии
+CREATE TABLE sessions (
+    id UUID PRIMARY KEY,
+    guid UUID NOT NULL,
+    token_hash VARCHAR UNIQUE NOT NULL,
+    user_agent_hash VARCHAR NOT NULL,
+    ip_hash VARCHAR NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX sessions_guid_idx ON sessions (guid);
+
+-- строки ref_tokens без семейства были закрыты при переходе на непрозрачные токены
+INSERT INTO sessions (id, guid, token_hash, user_agent_hash, ip_hash, expires_at, revoked_at, created_at, updated_at)
+SELECT f.id, f.guid, r.token_hash, r.user_agent_hash, r.ip_hash, r.expires_at,
+    CASE WHEN r.is_activated THEN f.revoked_at ELSE COALESCE(f.revoked_at, r.updated_at) END,
+    f.created_at, r.updated_at
+FROM token_families f JOIN ref_tokens r ON r.family_id = f.id;
+
+DELETE FROM refresh_tokens WHERE family_id NOT IN (SELECT id FROM sessions);
+
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_family_id_fkey;
+ALTER TABLE refresh_tokens RENAME COLUMN family_id TO session_id;
+ALTER TABLE refresh_tokens
+    ADD CONSTRAINT refresh_tokens_session_id_fkey FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE;
+ALTER INDEX refresh_tokens_family_id_idx RENAME TO refresh_tokens_session_id_idx;
+
+ALTER TABLE blacklist_used_tokens ADD COLUMN session_id UUID;
+
+UPDATE blacklist_used_tokens b SET session_id = s.id
+FROM ref_tokens r JOIN sessions s ON s.id = r.family_id
+WHERE r.id = b.id_ref_tokens;
+
+ALTER TABLE blacklist_used_tokens DROP COLUMN id_ref_tokens;
+ALTER TABLE blacklist_used_tokens
+    ADD CONSTRAINT blacklist_used_tokens_session_id_fkey FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE;
+
+DROP TABLE ref_tokens CASCADE;
+DROP TABLE token_families CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE TABLE token_families (
+    id UUID PRIMARY KEY,
+    guid UUID NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO token_families (id, guid, revoked_at, created_at)
+SELECT id, guid, revoked_at, created_at FROM sessions;
+
+-- в ref_tokens одна строка на пользователя: остается самая свежая сессия
+CREATE TABLE ref_tokens (
+    id SERIAL PRIMARY KEY,
+    guid UUID UNIQUE NOT NULL,
+    token_hash VARCHAR NOT NULL,
+    user_agent_hash VARCHAR NOT NULL,
+    ip_hash varchar NOT NULL,
+    is_activated BOOL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    family_id UUID REFERENCES token_families(id)
+);
+
+CREATE UNIQUE INDEX ref_tokens_token_hash_idx ON ref_tokens (token_hash);
+
+INSERT INTO ref_tokens (guid, token_hash, user_agent_hash, ip_hash, is_activated, created_at, updated_at, expires_at, family_id)
+SELECT DISTINCT ON (guid) guid, token_hash, user_agent_hash, ip_hash, revoked_at IS NULL, created_at, updated_at, expires_at, id
+FROM sessions
+ORDER BY guid, updated_at DESC;
+
+ALTER TABLE blacklist_used_tokens ADD COLUMN id_ref_tokens int REFERENCES ref_tokens(id);
+
+UPDATE blacklist_used_tokens b SET id_ref_tokens = r.id
+FROM ref_tokens r WHERE r.family_id = b.session_id;
+
+ALTER TABLE blacklist_used_tokens DROP COLUMN session_id;
+
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_session_id_fkey;
+ALTER TABLE refresh_tokens RENAME COLUMN session_id TO family_id;
+ALTER TABLE refresh_tokens
+    ADD CONSTRAINT refresh_tokens_family_id_fkey FOREIGN KEY (family_id) REFERENCES token_families(id) ON DELETE CASCADE;
+ALTER INDEX refresh_tokens_session_id_idx RENAME TO refresh_tokens_family_id_idx;
+
+DROP TABLE sessions CASCADE;
+-- +goose StatementEnd
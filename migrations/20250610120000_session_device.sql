@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- описание устройства и подсеть клиента для списка сессий пользователя.
+-- UA и IP по-прежнему хранятся только в виде bcrypt хешей
+ALTER TABLE sessions ADD COLUMN device VARCHAR NOT NULL DEFAULT 'unknown';
+ALTER TABLE sessions ADD COLUMN location VARCHAR NOT NULL DEFAULT 'unknown';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions DROP COLUMN location;
+ALTER TABLE sessions DROP COLUMN device;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- у каждого refresh токена свой jti. Access токен несет jti парного refresh токена (claim rti),
+-- поэтому пару можно найти точно, а не по близости времени выдачи
+ALTER TABLE refresh_tokens ADD COLUMN jti UUID;
+UPDATE refresh_tokens SET jti = gen_random_uuid();
+ALTER TABLE refresh_tokens ALTER COLUMN jti SET NOT NULL;
+CREATE UNIQUE INDEX refresh_tokens_jti_idx ON refresh_tokens (jti);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX refresh_tokens_jti_idx;
+ALTER TABLE refresh_tokens DROP COLUMN jti;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- в черном списке хранятся только HMAC-SHA256 отпечатки токенов (jwt.Fingerprint).
+-- bcrypt хеши с солью никогда не совпадали при проверке - удаляем их.
+-- Записи с самим access токеном переводит на отпечатки приложение при старте
+-- (RekeyBlacklist): ключа HMAC у миграции нет
+DELETE FROM blacklist_used_tokens WHERE used_token LIKE '$2_$%';
+
+ALTER TABLE blacklist_used_tokens RENAME COLUMN used_token TO fingerprint;
+ALTER TABLE blacklist_used_tokens ADD COLUMN created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+-- по fingerprint поиск идет через уникальный индекс столбца, отдельный индекс
+-- нужен только session_id: по нему черный список чистится вместе с сессией
+CREATE INDEX blacklist_used_tokens_session_id_idx ON blacklist_used_tokens (session_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX blacklist_used_tokens_session_id_idx;
+
+ALTER TABLE blacklist_used_tokens DROP COLUMN created_at;
+ALTER TABLE blacklist_used_tokens RENAME COLUMN fingerprint TO used_token;
+-- +goose StatementEnd
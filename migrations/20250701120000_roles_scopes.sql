@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+-- роли пользователей и scopes, которые они дают. Пользователь без записей в user_roles
+-- получает роли с is_default. Выданный сессии scope хранится в sessions.scope
+CREATE TABLE roles (
+    name VARCHAR PRIMARY KEY,
+    is_default BOOL NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE role_scopes (
+    role VARCHAR NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    scope VARCHAR NOT NULL,
+    PRIMARY KEY (role, scope)
+);
+
+CREATE TABLE user_roles (
+    guid UUID NOT NULL,
+    role VARCHAR NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    PRIMARY KEY (guid, role)
+);
+
+INSERT INTO roles (name, is_default) VALUES ('user', TRUE), ('admin', FALSE);
+
+INSERT INTO role_scopes (role, scope) VALUES
+    ('user', 'profile'),
+    ('user', 'sessions'),
+    ('admin', 'profile'),
+    ('admin', 'sessions'),
+    ('admin', 'admin');
+
+-- уже открытые сессии получают scope роли по умолчанию
+ALTER TABLE sessions ADD COLUMN scope VARCHAR NOT NULL DEFAULT 'profile sessions';
+ALTER TABLE sessions ALTER COLUMN scope SET DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions DROP COLUMN scope;
+DROP TABLE user_roles;
+DROP TABLE role_scopes;
+DROP TABLE roles;
+-- +goose StatementEnd
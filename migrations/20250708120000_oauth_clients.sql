@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- токены выпускаются только зарегистрированным клиентам. Доверенный клиент может
+-- выпускать токены для любого GUID, остальные - только для GUID из client_subjects
+CREATE TABLE oauth_clients (
+    id VARCHAR PRIMARY KEY,
+    name VARCHAR NOT NULL DEFAULT '',
+    secret_hash VARCHAR NOT NULL,
+    trusted BOOL NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    disabled_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE client_subjects (
+    client_id VARCHAR NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    guid UUID NOT NULL,
+    PRIMARY KEY (client_id, guid)
+);
+
+-- у сессий, открытых до появления клиентов, client_id пустой
+ALTER TABLE sessions ADD COLUMN client_id VARCHAR REFERENCES oauth_clients(id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions DROP COLUMN client_id;
+DROP TABLE client_subjects;
+DROP TABLE oauth_clients;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- scopes через пробел, которые клиент может получить на себя по client_credentials.
+-- Пусто - клиент не выпускает сервисные токены
+ALTER TABLE oauth_clients ADD COLUMN scope VARCHAR NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE oauth_clients DROP COLUMN scope;
+-- +goose StatementEnd
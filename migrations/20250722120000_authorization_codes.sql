@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- публичный клиент (браузерное или мобильное приложение) не может хранить секрет:
+-- он аутентифицируется только client_id и получает токены только по коду с PKCE
+ALTER TABLE oauth_clients ADD COLUMN public BOOL NOT NULL DEFAULT FALSE;
+
+CREATE TABLE client_redirect_uris (
+    client_id VARCHAR NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    redirect_uri VARCHAR NOT NULL,
+    PRIMARY KEY (client_id, redirect_uri)
+);
+
+-- коды хранятся только отпечатком, used_at ставится при обмене - второй обмен не пройдет
+CREATE TABLE authorization_codes (
+    code_hash VARCHAR PRIMARY KEY,
+    client_id VARCHAR NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    guid UUID NOT NULL,
+    redirect_uri VARCHAR NOT NULL,
+    scope VARCHAR NOT NULL DEFAULT '',
+    code_challenge VARCHAR NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX authorization_codes_expires_at_idx ON authorization_codes (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE authorization_codes;
+DROP TABLE client_redirect_uris;
+ALTER TABLE oauth_clients DROP COLUMN public;
+-- +goose StatementEnd
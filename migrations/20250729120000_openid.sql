@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- scope openid включает выдачу ID токена (OpenID Connect)
+INSERT INTO role_scopes (role, scope) VALUES
+    ('user', 'openid'),
+    ('admin', 'openid');
+
+-- auth_time - когда пользователь вошел. Для сессии, открытой по коду авторизации,
+-- это время входа сессии, из которой пришли в /authorize
+ALTER TABLE sessions ADD COLUMN auth_time TIMESTAMP WITH TIME ZONE;
+UPDATE sessions SET auth_time = created_at;
+ALTER TABLE sessions ALTER COLUMN auth_time SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE sessions ALTER COLUMN auth_time SET NOT NULL;
+
+ALTER TABLE authorization_codes ADD COLUMN nonce VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE authorization_codes ADD COLUMN auth_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE authorization_codes DROP COLUMN auth_time;
+ALTER TABLE authorization_codes DROP COLUMN nonce;
+ALTER TABLE sessions DROP COLUMN auth_time;
+DELETE FROM role_scopes WHERE scope = 'openid';
+-- +goose StatementEnd
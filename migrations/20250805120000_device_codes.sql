@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- запросы авторизации устройств (RFC 8628). device_code хранится только отпечатком,
+-- user_code вводит пользователь. status: pending -> approved/denied -> used
+CREATE TABLE device_codes (
+    device_code_hash VARCHAR PRIMARY KEY,
+    user_code VARCHAR NOT NULL UNIQUE,
+    client_id VARCHAR NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    scope VARCHAR NOT NULL DEFAULT '',
+    status VARCHAR NOT NULL DEFAULT 'pending',
+    guid UUID,
+    auth_time TIMESTAMP WITH TIME ZONE,
+    poll_interval INTEGER NOT NULL,
+    last_polled_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX device_codes_expires_at_idx ON device_codes (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE device_codes;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+-- token_exchange - клиенту разрешен обмен токенов (RFC 8693),
+-- audiences - через пробел, для каких сервисов клиент может запрашивать токены
+ALTER TABLE oauth_clients ADD COLUMN token_exchange BOOL NOT NULL DEFAULT FALSE;
+ALTER TABLE oauth_clients ADD COLUMN audiences VARCHAR NOT NULL DEFAULT '';
+
+-- поддержка может действовать от имени пользователя: actor_token со scope impersonate
+INSERT INTO roles (name, is_default) VALUES ('support', FALSE);
+
+INSERT INTO role_scopes (role, scope) VALUES
+    ('support', 'openid'),
+    ('support', 'profile'),
+    ('support', 'sessions'),
+    ('support', 'impersonate');
+
+-- журнал обменов: кто, через какого клиента и от чьего имени получил токен
+CREATE TABLE token_exchanges (
+    id SERIAL PRIMARY KEY,
+    jti UUID NOT NULL,
+    client_id VARCHAR NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    subject VARCHAR NOT NULL,
+    actor VARCHAR NOT NULL,
+    session_id UUID,
+    scope VARCHAR NOT NULL DEFAULT '',
+    audience VARCHAR NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX token_exchanges_subject_idx ON token_exchanges (subject);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE token_exchanges;
+DELETE FROM roles WHERE name = 'support';
+ALTER TABLE oauth_clients DROP COLUMN audiences;
+ALTER TABLE oauth_clients DROP COLUMN token_exchange;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- default_audience - aud токенов клиента, если он не запросил resource.
+-- Пусто - аудитория самого сервера авторизации (JWT_AUDIENCE)
+ALTER TABLE oauth_clients ADD COLUMN default_audience VARCHAR NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE oauth_clients DROP COLUMN default_audience;
+-- +goose StatementEnd
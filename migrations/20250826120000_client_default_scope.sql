@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- default_scope - scopes через пробел, которые клиент получает в /authorize без параметра scope.
+-- Пусто - scope обязателен
+ALTER TABLE oauth_clients ADD COLUMN default_scope VARCHAR NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE oauth_clients DROP COLUMN default_scope;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- отпечаток DPoP ключа (RFC 7638), к которому привязана пара, выданная вместе с refresh токеном.
+-- Пустая строка - пара не привязана. Повторный обмен в окне grace выдает access к тому же
+-- преемнику только с этим ключом, поэтому привязка не переходит к другому клиенту
+ALTER TABLE refresh_tokens ADD COLUMN jkt VARCHAR NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE refresh_tokens DROP COLUMN jkt;
+-- +goose StatementEnd